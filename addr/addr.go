@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/libreoscar/btcwatch/crypto"
 	"math/big"
 )
@@ -17,6 +18,11 @@ type BtcAddr struct {
 	Pubkey   []byte   // Unused for a stealth address
 	Enc58str string
 
+	// Set only for a native segwit address
+	SegwitVer int
+	Program   []byte
+	Hrp       string
+
 	// This is used only by the client
 	Extra struct {
 		Label  string
@@ -69,37 +75,66 @@ func NewAddrFromPubkey(in []byte, ver byte) (a *BtcAddr) {
 	return
 }
 
-func AddrVerPubkey(testnet bool) byte {
-	if testnet {
-		return 111
-	} else {
-		return 0
+func NewAddrFromWitnessProgram(ver int, prog []byte, hrp string) (a *BtcAddr) {
+	a = new(BtcAddr)
+	a.SegwitVer = ver
+	a.Program = make([]byte, len(prog))
+	copy(a.Program, prog)
+	a.Hrp = hrp
+	if ver == 0 && len(prog) == 20 {
+		copy(a.Hash160[:], prog)
 	}
+	return
 }
 
-func AddrVerScript(testnet bool) byte {
-	if testnet {
-		return 196
-	} else {
-		return 5
+func AddrVerPubkey(params *chaincfg.Params) byte {
+	return params.PubKeyHashAddrID
+}
+
+func AddrVerScript(params *chaincfg.Params) byte {
+	return params.ScriptHashAddrID
+}
+
+// Returns the witness version and program of a native segwit pk_script
+func witnessProgram(scr []byte) (ver int, prog []byte) {
+	if len(scr) < 4 || len(scr) > 42 || int(scr[1]) != len(scr)-2 {
+		return -1, nil
+	}
+	if scr[0] == 0x00 {
+		return 0, scr[2:]
+	} else if scr[0] >= 0x51 && scr[0] <= 0x60 {
+		return int(scr[0]) - 0x50, scr[2:]
 	}
+	return -1, nil
 }
 
-func NewAddrFromPkScript(scr []byte, testnet bool) *BtcAddr {
+func NewAddrFromPkScript(scr []byte, params *chaincfg.Params) *BtcAddr {
 	if len(scr) == 25 && scr[0] == 0x76 && scr[1] == 0xa9 && scr[2] == 0x14 && scr[23] == 0x88 && scr[24] == 0xac {
-		return NewAddrFromHash160(scr[3:23], AddrVerPubkey(testnet))
+		return NewAddrFromHash160(scr[3:23], AddrVerPubkey(params))
 	} else if len(scr) == 67 && scr[0] == 0x41 && scr[66] == 0xac {
-		return NewAddrFromPubkey(scr[1:66], AddrVerPubkey(testnet))
+		return NewAddrFromPubkey(scr[1:66], AddrVerPubkey(params))
 	} else if len(scr) == 35 && scr[0] == 0x21 && scr[34] == 0xac {
-		return NewAddrFromPubkey(scr[1:34], AddrVerPubkey(testnet))
+		return NewAddrFromPubkey(scr[1:34], AddrVerPubkey(params))
 	} else if len(scr) == 23 && scr[0] == 0xa9 && scr[1] == 0x14 && scr[22] == 0x87 {
-		return NewAddrFromHash160(scr[2:22], AddrVerScript(testnet))
+		return NewAddrFromHash160(scr[2:22], AddrVerScript(params))
+	} else if ver, prog := witnessProgram(scr); prog != nil {
+		if ver == 0 && len(prog) != 20 && len(prog) != 32 {
+			return nil
+		}
+		return NewAddrFromWitnessProgram(ver, prog, params.Bech32HRPSegwit)
 	}
 	return nil
 }
 
-// Base58 encoded address
+// Base58 encoded address, or bech32 encoded for a segwit one
 func (a *BtcAddr) String() string {
+	if a.Program != nil {
+		s, e := EncodeSegwit(a.Hrp, a.SegwitVer, a.Program)
+		if e != nil {
+			panic(e.Error())
+		}
+		return s
+	}
 	if a.Enc58str == "" {
 		var ad [25]byte
 		ad[0] = a.Version
@@ -181,7 +216,14 @@ func (a *BtcAddr) Owns(scr []byte) (yes bool) {
 }
 
 func (a *BtcAddr) OutScript() (res []byte) {
-	if a.Version == AddrVerPubkey(false) || a.Version == AddrVerPubkey(true) || a.Version == 48 /*Litecoin*/ {
+	if a.Program != nil {
+		res = make([]byte, 2+len(a.Program))
+		if a.SegwitVer > 0 {
+			res[0] = byte(0x50 + a.SegwitVer)
+		}
+		res[1] = byte(len(a.Program))
+		copy(res[2:], a.Program)
+	} else if chaincfg.IsPubKeyHashAddrID(a.Version) || a.Version == 48 /*Litecoin*/ {
 		res = make([]byte, 25)
 		res[0] = 0x76
 		res[1] = 0xa9
@@ -189,7 +231,7 @@ func (a *BtcAddr) OutScript() (res []byte) {
 		copy(res[3:23], a.Hash160[:])
 		res[23] = 0x88
 		res[24] = 0xac
-	} else if a.Version == AddrVerScript(false) || a.Version == AddrVerScript(true) {
+	} else if chaincfg.IsScriptHashAddrID(a.Version) {
 		res = make([]byte, 23)
 		res[0] = 0xa9
 		res[1] = 20
@@ -1,6 +1,9 @@
 package addr
 
 import (
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg"
+	"strings"
 	"testing"
 )
 
@@ -89,3 +92,79 @@ func TestAddr(t *testing.T) {
 		}
 	}
 }
+
+func TestSegwitAddr(t *testing.T) {
+	var ta = []struct {
+		addr   string
+		hrp    string
+		script string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "bc",
+			"0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "tb",
+			"00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "bc",
+			"5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"BC1SW50QGDZ25J", "bc", "6002751e"},
+		{"bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", "bcrt",
+			"0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+	}
+
+	for i := range ta {
+		ver, prog, e := DecodeSegwit(ta[i].hrp, ta[i].addr)
+		if e != nil {
+			t.Error("DecodeSegwit caused error", ta[i].addr, e.Error())
+			continue
+		}
+		a := NewAddrFromWitnessProgram(ver, prog, ta[i].hrp)
+		if hex.EncodeToString(a.OutScript()) != ta[i].script {
+			t.Error("OutScript failed", ta[i].addr)
+		}
+		if a.String() != strings.ToLower(ta[i].addr) {
+			t.Error("EncodeSegwit failed", ta[i].addr, a.String())
+		}
+	}
+
+	var bad = []string{
+		"tc1qw508d6qejxtdg4y5r3zarvary0c5xw7kg3g4ty",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",
+		"BC13W508D6QEJXTDG4Y5R3ZARVARY0C5XW7KN40WF2",
+		"bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du",
+		"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3pjxtptv",
+		"bc1gmk9yu",
+	}
+	for i := range bad {
+		if _, _, e := DecodeSegwit("bc", bad[i]); e == nil {
+			t.Error("DecodeSegwit accepted", bad[i])
+		}
+	}
+}
+
+func TestPkScriptNetworks(t *testing.T) {
+	p2pkh, _ := hex.DecodeString("76a914751e76e8199196d454941c45d1b3a323f1433bd688ac")
+	p2wpkh, _ := hex.DecodeString("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+
+	var ta = []struct {
+		params *chaincfg.Params
+		p2pkh  string
+		p2wpkh string
+	}{
+		{&chaincfg.MainNetParams, "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+			"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{&chaincfg.TestNet3Params, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r",
+			"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"},
+		{&chaincfg.RegressionNetParams, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r",
+			"bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"},
+	}
+
+	for i := range ta {
+		a := NewAddrFromPkScript(p2pkh, ta[i].params)
+		if a == nil || a.String() != ta[i].p2pkh {
+			t.Error("P2PKH address failed on", ta[i].params.Name)
+		}
+		a = NewAddrFromPkScript(p2wpkh, ta[i].params)
+		if a == nil || a.String() != ta[i].p2wpkh {
+			t.Error("P2WPKH address failed on", ta[i].params.Name)
+		}
+	}
+}
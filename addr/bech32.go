@@ -0,0 +1,166 @@
+package addr
+
+import (
+	"errors"
+	"strings"
+)
+
+// Bech32 (BIP173) and bech32m (BIP350) encoding of segwit addresses
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (b>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	res := make([]byte, 0, len(hrp)*2+1)
+	for i := range hrp {
+		res = append(res, hrp[i]>>5)
+	}
+	res = append(res, 0)
+	for i := range hrp {
+		res = append(res, hrp[i]&31)
+	}
+	return res
+}
+
+func bech32Checksum(hrp string, data []byte, spec uint32) []byte {
+	values := append(bech32HrpExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := bech32Polymod(values) ^ spec
+	res := make([]byte, 6)
+	for i := range res {
+		res[i] = byte((mod >> uint(5*(5-i))) & 31)
+	}
+	return res
+}
+
+// Regroups a slice of frombits-wide values into tobits-wide values
+func convertBits(data []byte, frombits, tobits uint, pad bool) ([]byte, error) {
+	acc := uint32(0)
+	bits := uint(0)
+	maxv := uint32(1)<<tobits - 1
+	var res []byte
+	for _, v := range data {
+		if uint32(v)>>frombits != 0 {
+			return nil, errors.New("Invalid data range")
+		}
+		acc = acc<<frombits | uint32(v)
+		bits += frombits
+		for bits >= tobits {
+			bits -= tobits
+			res = append(res, byte((acc>>bits)&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			res = append(res, byte((acc<<(tobits-bits))&maxv))
+		}
+	} else if bits >= frombits || (acc<<(tobits-bits))&maxv != 0 {
+		return nil, errors.New("Invalid padding")
+	}
+	return res, nil
+}
+
+// Returns the bech32 (version 0) or bech32m (version 1+) encoding of a
+// witness program
+func EncodeSegwit(hrp string, version int, program []byte) (string, error) {
+	if version < 0 || version > 16 {
+		return "", errors.New("Invalid witness version")
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return "", errors.New("Invalid witness program length")
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return "", errors.New("Invalid witness v0 program length")
+	}
+	conv, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	spec := uint32(bech32Const)
+	if version > 0 {
+		spec = bech32mConst
+	}
+	hrp = strings.ToLower(hrp)
+	data := append([]byte{byte(version)}, conv...)
+	data = append(data, bech32Checksum(hrp, data, spec)...)
+	s := make([]byte, 0, len(hrp)+1+len(data))
+	s = append(s, hrp...)
+	s = append(s, '1')
+	for _, d := range data {
+		s = append(s, bech32Charset[d])
+	}
+	return string(s), nil
+}
+
+// Decodes a segwit address, checking that it belongs to the given hrp
+func DecodeSegwit(hrp string, s string) (version int, program []byte, e error) {
+	if len(s) > 90 {
+		e = errors.New("Address too long")
+		return
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		e = errors.New("Mixed case address")
+		return
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndex(s, "1")
+	if pos < 1 || pos+7 > len(s) {
+		e = errors.New("Invalid separator position")
+		return
+	}
+	if s[:pos] != strings.ToLower(hrp) {
+		e = errors.New("Address has wrong hrp " + s[:pos])
+		return
+	}
+	data := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			e = errors.New("Invalid bech32 character")
+			return
+		}
+		data = append(data, byte(d))
+	}
+	if len(data) < 7 {
+		e = errors.New("Address too short")
+		return
+	}
+	version = int(data[0])
+	spec := uint32(bech32Const)
+	if version > 0 {
+		spec = bech32mConst
+	}
+	if bech32Polymod(append(bech32HrpExpand(s[:pos]), data...)) != spec {
+		e = errors.New("Address Checksum error")
+		return
+	}
+	program, e = convertBits(data[1:len(data)-6], 5, 8, false)
+	if e != nil {
+		return
+	}
+	if version > 16 || len(program) < 2 || len(program) > 40 ||
+		(version == 0 && len(program) != 20 && len(program) != 32) {
+		e = errors.New("Invalid witness program")
+		program = nil
+	}
+	return
+}
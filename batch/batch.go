@@ -0,0 +1,126 @@
+// Package batch reads the files of opreturn's sendbatch and decides which of
+// their rows to send, apart from any wallet so it can be tested.
+package batch
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcutil"
+	"github.com/libreoscar/btcwatch/txbuild"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// How the rows are sent
+const (
+	// One tx per row, each spending the change of the previous one
+	Chain = "chain"
+	// A single tx paying every row, or none
+	Multi = "multi"
+)
+
+var ErrEmpty = errors.New("empty batch")
+
+// A line of a batch file
+type Row struct {
+	Address string
+	Amount  Amount
+	Message string
+}
+
+// An amount written as a JSON string ("0.001", "100sat") or number (0.001)
+type Amount string
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = Amount(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("amount %s is neither a string nor a number", data)
+	}
+	*a = Amount(n)
+	return nil
+}
+
+// Parse reads a JSON array of {"Address", "Amount", "Message"} objects, or
+// CSV lines of address,amount,message with an optional header. name is the
+// file's, a .json one is always JSON.
+func Parse(name string, data []byte) ([]Row, error) {
+	trimmed := bytes.TrimSpace(data)
+	if strings.EqualFold(filepath.Ext(name), ".json") || bytes.HasPrefix(trimmed, []byte("[")) {
+		var rows []Row
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rows); err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		return rows, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		if len(rows) == 0 && strings.EqualFold(record[0], "address") {
+			continue
+		}
+		rows = append(rows, Row{record[0], Amount(record[1]), record[2]})
+	}
+	return rows, nil
+}
+
+// The outcome of a row, as written to the report
+type Result struct {
+	Row     int
+	Address string
+	Amount  string
+	Txid    string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// Check parses the amount of every row and returns a result per row, with an
+// Error for the rows not to send. In Multi mode one invalid row fails them
+// all.
+func Check(rows []Row, mode string) ([]Result, []btcutil.Amount, error) {
+	if mode != Chain && mode != Multi {
+		return nil, nil, fmt.Errorf("unknown batch mode %q, use %s or %s", mode, Chain, Multi)
+	}
+	if len(rows) == 0 {
+		return nil, nil, ErrEmpty
+	}
+	results := make([]Result, len(rows))
+	amounts := make([]btcutil.Amount, len(rows))
+	valid := true
+	for i, row := range rows {
+		results[i] = Result{Row: i + 1, Address: row.Address, Amount: string(row.Amount)}
+		amount, err := txbuild.ParseAmount(string(row.Amount))
+		if err != nil {
+			results[i].Error = err.Error()
+			valid = false
+			continue
+		}
+		amounts[i] = amount
+	}
+	if mode == Multi && !valid {
+		for i := range results {
+			if results[i].Error == "" {
+				results[i].Error = "not sent, another row is invalid"
+			}
+		}
+	}
+	return results, amounts, nil
+}
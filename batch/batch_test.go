@@ -0,0 +1,102 @@
+package batch
+
+import (
+	"github.com/btcsuite/btcutil"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	rows, err := Parse("rows.csv", []byte("address,amount,message\n"+
+		"addr1, 0.001, hello\n"+
+		"addr2,546sat,\"a, quoted\nmessage\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{{"addr1", "0.001", "hello"}, {"addr2", "546sat", "a, quoted\nmessage"}}
+	if len(rows) != len(want) {
+		t.Fatal("wrong rows", rows)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Error("wrong row", i, rows[i])
+		}
+	}
+
+	// Without header, and a later "address" is a row
+	rows, err = Parse("rows", []byte("addr1,1,a\naddress,2,b\n"))
+	if err != nil || len(rows) != 2 || rows[1].Address != "address" {
+		t.Error("wrong rows", rows, err)
+	}
+	if rows, err := Parse("rows.csv", nil); err != nil || len(rows) != 0 {
+		t.Error("empty file", rows, err)
+	}
+	for _, data := range []string{"addr1,1\n", "addr1,1,a,b\n", "addr1,1,\"a\n"} {
+		if _, err := Parse("rows.csv", []byte(data)); err == nil {
+			t.Errorf("%q parsed", data)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	rows, err := Parse("rows", []byte(` [{"Address": "addr1", "Amount": 0.001, "Message": "hi"},
+		{"Address": "addr2", "Amount": "546sat"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0] != (Row{"addr1", "0.001", "hi"}) || rows[1] != (Row{"addr2", "546sat", ""}) {
+		t.Error("wrong rows", rows)
+	}
+	for name, data := range map[string]string{
+		"unknown field":  `[{"Address": "addr1", "Amount": 1, "Memo": "x"}]`,
+		"bool amount":    `[{"Address": "addr1", "Amount": true}]`,
+		"not an array":   `{"Address": "addr1"}`,
+		"truncated":      `[{"Address": "addr1"`,
+		".json with csv": "addr1,1,a\n",
+	} {
+		if _, err := Parse("rows.json", []byte(data)); err == nil {
+			t.Error(name, "parsed")
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rows := []Row{{"addr1", "0.001", "a"}, {"addr2", "lots", "b"}, {"addr3", "546sat", "c"}}
+
+	results, amounts, err := Check(rows, Chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Error != "" || results[1].Error == "" || results[2].Error != "" {
+		t.Error("chain sends the valid rows", results)
+	}
+	if amounts[0] != 100000 || amounts[2] != 546 {
+		t.Error("wrong amounts", amounts)
+	}
+	if results[2].Row != 3 || results[2].Address != "addr3" || results[2].Amount != "546sat" {
+		t.Error("wrong result", results[2])
+	}
+
+	results, _, err = Check(rows, Multi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Error == "" {
+			t.Error("multi sends a row beside an invalid one", r)
+		}
+	}
+	if results[1].Error == results[0].Error {
+		t.Error("the invalid row lost its own error", results[1])
+	}
+
+	results, amounts, err = Check(rows[:1], Multi)
+	if err != nil || results[0].Error != "" || amounts[0] != btcutil.Amount(100000) {
+		t.Error("valid multi batch refused", results, err)
+	}
+	if _, _, err := Check(nil, Chain); err != ErrEmpty {
+		t.Error("empty batch", err)
+	}
+	if _, _, err := Check(rows, "all"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
@@ -0,0 +1,80 @@
+// Package braft encodes the braft OP_RETURN payload: the "braft" magic, a
+// version byte, then the version's fields. Version 1 carries the receiver of
+// the transfer, a 20 byte braft account.
+package braft
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const Magic = "braft"
+
+const (
+	Version1 = 1
+
+	// Latest is what Encode writes
+	Latest = Version1
+)
+
+// ReceiverSize is the length of a braft account
+const ReceiverSize = 20
+
+var ErrNotBraft = errors.New("not a braft payload")
+
+// Transfer is a decoded braft payload
+type Transfer struct {
+	Version  byte
+	Receiver []byte
+}
+
+// Encode returns the payload of a transfer to receiver, in the latest version
+func Encode(receiver []byte) ([]byte, error) {
+	if err := checkReceiver(receiver); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	buf.WriteByte(Latest)
+	buf.Write(receiver)
+	return buf.Bytes(), nil
+}
+
+// ParseReceiver decodes a hex encoded receiver
+func ParseReceiver(s string) ([]byte, error) {
+	receiver, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid braft receiver %q: %s", s, err)
+	}
+	return receiver, checkReceiver(receiver)
+}
+
+// Decode parses a payload, ErrNotBraft when the magic is missing
+func Decode(payload []byte) (*Transfer, error) {
+	if !bytes.HasPrefix(payload, []byte(Magic)) {
+		return nil, ErrNotBraft
+	}
+	rest := payload[len(Magic):]
+	if len(rest) == 0 {
+		return nil, fmt.Errorf("braft payload without version")
+	}
+	switch version := rest[0]; version {
+	case Version1:
+		receiver := rest[1:]
+		if err := checkReceiver(receiver); err != nil {
+			return nil, err
+		}
+		return &Transfer{version, append([]byte(nil), receiver...)}, nil
+	default:
+		return nil, fmt.Errorf("unknown braft version %d", version)
+	}
+}
+
+func checkReceiver(receiver []byte) error {
+	if len(receiver) != ReceiverSize {
+		return fmt.Errorf("braft receiver is %d bytes, want %d", len(receiver), ReceiverSize)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package braft
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+const receiverHex = "00112233445566778899aabbccddeeff00112233"
+
+func TestEncodeDecode(t *testing.T) {
+	receiver, err := ParseReceiver(receiverHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := Encode(receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// What opreturn's sendbraft has always written
+	if hex.EncodeToString(payload) != "627261667401"+receiverHex {
+		t.Errorf("wrong payload %x", payload)
+	}
+	transfer, err := Decode(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Version != Version1 || !bytes.Equal(transfer.Receiver, receiver) {
+		t.Error("wrong transfer", transfer)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		payload string
+	}{
+		{"no version", "6272616674"},
+		{"unknown version", "627261667402" + receiverHex},
+		{"short receiver", "627261667401" + receiverHex[2:]},
+		{"long receiver", "627261667401" + receiverHex + "44"},
+	}
+	for _, test := range tests {
+		payload, _ := hex.DecodeString(test.payload)
+		if _, err := Decode(payload); err == nil || err == ErrNotBraft {
+			t.Error(test.name, "wrong error", err)
+		}
+	}
+	if _, err := Decode([]byte("hello")); err != ErrNotBraft {
+		t.Error("hello decoded", err)
+	}
+	if _, err := ParseReceiver("zz"); err == nil {
+		t.Error("invalid hex accepted")
+	}
+	if _, err := Encode([]byte{1, 2, 3}); err == nil {
+		t.Error("short receiver encoded")
+	}
+}
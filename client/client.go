@@ -1,19 +1,23 @@
 package main
 
 import (
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/libreoscar/btcwatch/message"
-	"github.com/davecgh/go-spew/spew"
 	zmq "github.com/pebbe/zmq4"
 )
 
 func main() {
+	endpoint := flag.String("connect", "tcp://188.166.253.98:8001", "watcher ZMQ endpoint")
+	flag.Parse()
+
 	receiver, _ := zmq.NewSocket(zmq.SUB)
 	defer receiver.Close()
-	err := receiver.Connect("tcp://188.166.253.98:8001")
+	err := receiver.Connect(*endpoint)
 	if err != nil {
 		fmt.Println("failed to connect server")
 		return
@@ -32,10 +36,42 @@ func main() {
 			//  process msg
 			fmt.Println("Got message!")
 			processedBlock := &message.ProcessedBlock{}
-			proto.Unmarshal(data, processedBlock)
-			spew.Dump(processedBlock)
+			if err := proto.Unmarshal(data, processedBlock); err != nil {
+				fmt.Println("invalid block:", err)
+				continue
+			}
+			printBlock(processedBlock)
 		}
 		//  No activity, so sleep for 1 millisecond before checking again
 		time.Sleep(time.Millisecond)
 	}
 }
+
+// Prints the OP_RETURN payloads of the block. Payloads come as bytes in
+// data, msg only has the text ones; a watcher older than data only sets msg.
+func printBlock(block *message.ProcessedBlock) {
+	fmt.Printf("block %d, %d txs\n", block.BlockIndex, len(block.Txs))
+	for _, tx := range block.Txs {
+		for i, result := range tx.Result {
+			switch {
+			case result.GetBraft() != nil:
+				braft := result.GetBraft()
+				fmt.Printf("  %s:%d braft v%d receiver %s\n", tx.Txid, i, braft.Version, hex.EncodeToString(braft.Receiver))
+			case result.GetMsg() != nil:
+				msg := result.GetMsg()
+				data := msg.Data
+				if data == nil {
+					data = []byte(msg.Msg)
+				}
+				fmt.Printf("  %s:%d data %s", tx.Txid, i, hex.EncodeToString(data))
+				if msg.Msg != "" {
+					fmt.Printf(" text %q", msg.Msg)
+				}
+				fmt.Println()
+			case result.GetTransfer() != nil:
+				transfer := result.GetTransfer()
+				fmt.Printf("  %s:%d %d sat to %s\n", tx.Txid, i, transfer.Value, transfer.Address)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package coinselect picks the wallet outputs funding a transaction. The
+// strategies are pure functions over a UTXO set so they can be tested without
+// a wallet.
+package coinselect
+
+import (
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcutil"
+	"sort"
+	"strings"
+)
+
+var ErrInsufficientFunds = errors.New("not enough funds")
+
+// How many branches BranchAndBound explores before giving up
+const bnbMaxTries = 100000
+
+type UTXO struct {
+	TxID          string
+	Vout          uint32
+	Amount        btcutil.Amount
+	Confirmations int64
+	// Change of our own txs, spendable before it confirms
+	Trusted bool
+}
+
+// A Strategy returns outputs of utxos worth at least target, or
+// ErrInsufficientFunds. It must not modify utxos.
+type Strategy func(utxos []UTXO, target btcutil.Amount) ([]UTXO, error)
+
+// Takes the outputs in the order given, what the tool always did
+func InOrder(utxos []UTXO, target btcutil.Amount) ([]UTXO, error) {
+	return accumulate(utxos, target)
+}
+
+// Fewest inputs, cheapest tx now
+func LargestFirst(utxos []UTXO, target btcutil.Amount) ([]UTXO, error) {
+	return accumulate(sorted(utxos, true), target)
+}
+
+// Consolidates small outputs, more inputs and a higher fee
+func SmallestFirst(utxos []UTXO, target btcutil.Amount) ([]UTXO, error) {
+	return accumulate(sorted(utxos, false), target)
+}
+
+// BranchAndBound looks for outputs adding up to target without exceeding it
+// by more than costOfChange, so the tx needs no change output. When there is
+// no such set it falls back to LargestFirst.
+func BranchAndBound(costOfChange btcutil.Amount) Strategy {
+	return func(utxos []UTXO, target btcutil.Amount) ([]UTXO, error) {
+		if best := bnb(sorted(utxos, true), target, target+costOfChange); best != nil {
+			return best, nil
+		}
+		return LargestFirst(utxos, target)
+	}
+}
+
+// MinConf wraps s to only consider trusted outputs and outputs with at least
+// minConf confirmations
+func MinConf(s Strategy, minConf int64) Strategy {
+	return func(utxos []UTXO, target btcutil.Amount) ([]UTXO, error) {
+		var confirmed []UTXO
+		for _, utxo := range utxos {
+			if utxo.Trusted || utxo.Confirmations >= minConf {
+				confirmed = append(confirmed, utxo)
+			}
+		}
+		selected, err := s(confirmed, target)
+		if err == ErrInsufficientFunds && len(confirmed) < len(utxos) {
+			return nil, fmt.Errorf("%s with %d confirmations", err, minConf)
+		}
+		return selected, err
+	}
+}
+
+// Names accepted by Lookup
+var Names = []string{"bnb", "largest-first", "smallest-first", "in-order"}
+
+func Lookup(name string, costOfChange btcutil.Amount) (Strategy, error) {
+	switch name {
+	case "bnb":
+		return BranchAndBound(costOfChange), nil
+	case "largest-first":
+		return LargestFirst, nil
+	case "smallest-first":
+		return SmallestFirst, nil
+	case "in-order":
+		return InOrder, nil
+	}
+	return nil, fmt.Errorf("unknown coin selection %q, use one of %s", name, strings.Join(Names, ", "))
+}
+
+func Total(utxos []UTXO) btcutil.Amount {
+	var total btcutil.Amount
+	for _, utxo := range utxos {
+		total += utxo.Amount
+	}
+	return total
+}
+
+func accumulate(utxos []UTXO, target btcutil.Amount) ([]UTXO, error) {
+	var total btcutil.Amount
+	for i, utxo := range utxos {
+		total += utxo.Amount
+		if total >= target {
+			return append([]UTXO(nil), utxos[:i+1]...), nil
+		}
+	}
+	return nil, ErrInsufficientFunds
+}
+
+// Sorted copy, ties broken by outpoint so the result is deterministic
+func sorted(utxos []UTXO, descending bool) []UTXO {
+	s := append([]UTXO(nil), utxos...)
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].Amount != s[j].Amount {
+			return (s[i].Amount > s[j].Amount) == descending
+		}
+		if s[i].TxID != s[j].TxID {
+			return s[i].TxID < s[j].TxID
+		}
+		return s[i].Vout < s[j].Vout
+	})
+	return s
+}
+
+// Depth-first search over include/exclude decisions on utxos sorted by
+// decreasing amount. Returns the set in [low, high] with the least excess,
+// nil when none was found within bnbMaxTries.
+func bnb(utxos []UTXO, low, high btcutil.Amount) []UTXO {
+	// remaining[i] is the sum of utxos[i:]
+	remaining := make([]btcutil.Amount, len(utxos)+1)
+	for i := len(utxos) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + utxos[i].Amount
+	}
+
+	var best []int
+	bestExcess := btcutil.Amount(-1)
+	var picked []int
+	tries := 0
+
+	var search func(i int, total btcutil.Amount)
+	search = func(i int, total btcutil.Amount) {
+		tries++
+		if tries > bnbMaxTries || total > high || total+remaining[i] < low {
+			return
+		}
+		if total >= low {
+			if bestExcess < 0 || total-low < bestExcess {
+				best = append(best[:0], picked...)
+				bestExcess = total - low
+			}
+			// Adding more only increases the excess
+			return
+		}
+		if i == len(utxos) {
+			return
+		}
+		picked = append(picked, i)
+		search(i+1, total+utxos[i].Amount)
+		picked = picked[:len(picked)-1]
+		if bestExcess == 0 {
+			return
+		}
+		search(i+1, total)
+	}
+	search(0, 0)
+
+	if bestExcess < 0 {
+		return nil
+	}
+	selected := make([]UTXO, len(best))
+	for i, idx := range best {
+		selected[i] = utxos[idx]
+	}
+	return selected
+}
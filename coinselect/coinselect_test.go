@@ -0,0 +1,107 @@
+package coinselect
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcutil"
+	"testing"
+)
+
+// Outputs of the given amounts, in satoshis, with as many confirmations as
+// their position
+func utxoSet(amounts ...btcutil.Amount) []UTXO {
+	utxos := make([]UTXO, len(amounts))
+	for i, amount := range amounts {
+		utxos[i] = UTXO{
+			TxID:          fmt.Sprintf("%064x", i),
+			Amount:        amount,
+			Confirmations: int64(i),
+		}
+	}
+	return utxos
+}
+
+func amounts(utxos []UTXO) []btcutil.Amount {
+	a := make([]btcutil.Amount, len(utxos))
+	for i, utxo := range utxos {
+		a[i] = utxo.Amount
+	}
+	return a
+}
+
+func sameAmounts(utxos []UTXO, want ...btcutil.Amount) bool {
+	return fmt.Sprint(amounts(utxos)) == fmt.Sprint(want)
+}
+
+func TestStrategies(t *testing.T) {
+	utxos := utxoSet(3000, 50000, 1000, 20000, 7000)
+
+	var tests = []struct {
+		name     string
+		strategy Strategy
+		target   btcutil.Amount
+		want     []btcutil.Amount
+	}{
+		{"in-order", InOrder, 52000, []btcutil.Amount{3000, 50000}},
+		{"largest-first", LargestFirst, 52000, []btcutil.Amount{50000, 20000}},
+		{"smallest-first", SmallestFirst, 10000, []btcutil.Amount{1000, 3000, 7000}},
+		{"bnb exact", BranchAndBound(0), 27000, []btcutil.Amount{20000, 7000}},
+		{"bnb within change cost", BranchAndBound(500), 23800, []btcutil.Amount{20000, 3000, 1000}},
+		{"bnb fallback", BranchAndBound(0), 80500, []btcutil.Amount{50000, 20000, 7000, 3000, 1000}},
+		{"minconf", MinConf(LargestFirst, 2), 20000, []btcutil.Amount{20000}},
+		{"minconf skips", MinConf(LargestFirst, 3), 25000, []btcutil.Amount{20000, 7000}},
+	}
+	for _, test := range tests {
+		selected, err := test.strategy(utxos, test.target)
+		if err != nil {
+			t.Error(test.name, err)
+			continue
+		}
+		if !sameAmounts(selected, test.want...) {
+			t.Error(test.name, "selected", amounts(selected), "want", test.want)
+		}
+		if Total(selected) < test.target {
+			t.Error(test.name, "selected less than the target")
+		}
+	}
+	if !sameAmounts(utxos, 3000, 50000, 1000, 20000, 7000) {
+		t.Error("strategies modified the utxo set")
+	}
+}
+
+func TestInsufficientFunds(t *testing.T) {
+	utxos := utxoSet(3000, 50000, 1000)
+	for _, name := range Names {
+		s, err := Lookup(name, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s(utxos, 54001); err != ErrInsufficientFunds {
+			t.Error(name, "wrong error", err)
+		}
+		if _, err := s(nil, 1); err != ErrInsufficientFunds {
+			t.Error(name, "wrong error on an empty set", err)
+		}
+	}
+	if _, err := MinConf(LargestFirst, 2)(utxos, 2000); err == nil || err == ErrInsufficientFunds {
+		t.Error("minconf should explain the shortfall", err)
+	}
+	utxos[0].Trusted = true
+	if selected, err := MinConf(LargestFirst, 2)(utxos, 2000); err != nil || !sameAmounts(selected, 3000) {
+		t.Error("minconf should take trusted outputs", amounts(selected), err)
+	}
+	if _, err := Lookup("random", 0); err == nil {
+		t.Error("Lookup accepted random")
+	}
+}
+
+func TestBranchAndBoundLargeSet(t *testing.T) {
+	// 1000..200000 sat, the search must stay bounded and still find a match
+	var set []btcutil.Amount
+	for i := btcutil.Amount(1); i <= 200; i++ {
+		set = append(set, i*1000)
+	}
+	selected, err := BranchAndBound(0)(utxoSet(set...), 1234000)
+	if err != nil || Total(selected) != 1234000 {
+		t.Error("no exact match", amounts(selected), err)
+	}
+}
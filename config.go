@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/libreoscar/btcwatch/logging"
+	"github.com/libreoscar/btcwatch/netparams"
+	"github.com/libreoscar/btcwatch/rpcauth"
+	"github.com/libreoscar/btcwatch/rpcretry"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables overriding the settings of the config file
+const (
+	envRPCHost        = "BTCWATCH_RPC_HOST"
+	envRPCUser        = "BTCWATCH_RPC_USER"
+	envRPCPass        = "BTCWATCH_RPC_PASS"
+	envRPCPassFile    = "BTCWATCH_RPC_PASS_FILE"
+	envRPCCookieFile  = "BTCWATCH_RPC_COOKIE"
+	envRPCTLS         = "BTCWATCH_RPC_TLS"
+	envRPCCertFile    = "BTCWATCH_RPC_CERT"
+	envNetwork        = "BTCWATCH_NETWORK"
+	envHttpListen     = "BTCWATCH_HTTP_LISTEN"
+	envSinks          = "BTCWATCH_SINKS"
+	envFilterPrefixes = "BTCWATCH_FILTER_PREFIXES"
+	envLogLevel       = "BTCWATCH_LOG_LEVEL"
+	envLogFormat      = "BTCWATCH_LOG_FORMAT"
+	envCheckpointFile = "BTCWATCH_CHECKPOINT"
+)
+
+type SinkConf struct {
+	Type    string // "zmq" or "file"
+	Address string // bind endpoint for zmq, path for file
+}
+
+type FilterConf struct {
+	// Only OP_RETURN payloads starting with one of these hex prefixes are
+	// published. Empty means every payload.
+	Prefixes []string
+	// Publish only the OP_RETURN outputs of a tx, not its value transfers
+	NoTransfers bool
+	// Don't publish blocks without any matching tx
+	SkipEmpty bool
+}
+
+type Config struct {
+	// bitcoind RPC endpoint
+	Host string
+	rpcauth.Conf
+	RPCRetry rpcretry.Policy
+
+	Network       string
+	CustomNetwork *netparams.Custom
+
+	HttpListen string
+	Sinks      []SinkConf
+	Filters    FilterConf
+	LogLevel   string
+	LogFormat  string // "text" or "json"
+	// Dump every processed block at the debug level
+	DumpBlocks bool
+	// Also put binary payloads in OpReturnMsg.msg, hex encoded, and braft
+	// ones as well, for subscribers not reading data yet.
+	// Deprecated: temporary, removed in v0.2.0.
+	LegacyMsgField bool
+
+	// Where the last published block is saved, empty disables it
+	CheckpointFile string
+	// How long in-flight blocks get to finish on SIGINT/SIGTERM
+	ShutdownTimeout string
+
+	netParams       *chaincfg.Params
+	prefixes        [][]byte
+	shutdownTimeout time.Duration
+	logLevel        slog.Level
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		HttpListen:      "127.0.0.1:8000",
+		Sinks:           []SinkConf{{Type: "zmq", Address: "tcp://*:8001"}},
+		LogLevel:        "info",
+		LogFormat:       "text",
+		ShutdownTimeout: "30s",
+		RPCRetry:        rpcretry.DefaultPolicy(),
+	}
+}
+
+// Reads the config file at path, applies the environment overrides and
+// validates the result
+func loadConf(path string) (*Config, error) {
+	conf := defaultConfig()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %s", err)
+	}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %s", path, err)
+	}
+	if err := conf.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := conf.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %s", path, err)
+	}
+	return conf, nil
+}
+
+func (c *Config) applyEnv() error {
+	for env, field := range map[string]*string{
+		envRPCHost:        &c.Host,
+		envRPCUser:        &c.User,
+		envRPCPass:        &c.Pass,
+		envRPCPassFile:    &c.PassFile,
+		envRPCCookieFile:  &c.CookieFile,
+		envRPCCertFile:    &c.CertFile,
+		envNetwork:        &c.Network,
+		envHttpListen:     &c.HttpListen,
+		envLogLevel:       &c.LogLevel,
+		envLogFormat:      &c.LogFormat,
+		envCheckpointFile: &c.CheckpointFile,
+	} {
+		if v, ok := os.LookupEnv(env); ok {
+			*field = v
+		}
+	}
+	if v, ok := os.LookupEnv(envRPCTLS); ok {
+		tls, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s: %s", envRPCTLS, err)
+		}
+		c.TLS = tls
+	}
+	// BTCWATCH_SINKS="zmq=tcp://*:8001,file=/var/lib/btcwatch/blocks"
+	if v, ok := os.LookupEnv(envSinks); ok {
+		c.Sinks = nil
+		for _, s := range splitList(v) {
+			parts := strings.SplitN(s, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("%s: sink %q isn't type=address", envSinks, s)
+			}
+			c.Sinks = append(c.Sinks, SinkConf{Type: parts[0], Address: parts[1]})
+		}
+	}
+	if v, ok := os.LookupEnv(envFilterPrefixes); ok {
+		c.Filters.Prefixes = splitList(v)
+	}
+	return nil
+}
+
+func splitList(s string) (res []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return
+}
+
+func (c *Config) validate() (err error) {
+	if c.Host == "" {
+		return fmt.Errorf("Host is required")
+	}
+	if err := c.Conf.Validate(); err != nil {
+		return err
+	}
+	if err := c.RPCRetry.Validate(); err != nil {
+		return fmt.Errorf("RPCRetry: %s", err)
+	}
+	c.netParams, err = netparams.Lookup(c.Network, c.CustomNetwork)
+	if err != nil {
+		return err
+	}
+	if c.HttpListen == "" {
+		return fmt.Errorf("HttpListen is required")
+	}
+	if len(c.Sinks) == 0 {
+		return fmt.Errorf("at least one sink is required")
+	}
+	for _, s := range c.Sinks {
+		if s.Type != "zmq" && s.Type != "file" {
+			return fmt.Errorf("unknown sink type %q", s.Type)
+		}
+		if s.Address == "" {
+			return fmt.Errorf("%s sink needs an address", s.Type)
+		}
+	}
+	c.prefixes = nil
+	for _, p := range c.Filters.Prefixes {
+		prefix, err := hex.DecodeString(p)
+		if err != nil {
+			return fmt.Errorf("filter prefix %q isn't hex", p)
+		}
+		c.prefixes = append(c.prefixes, prefix)
+	}
+	c.shutdownTimeout, err = time.ParseDuration(c.ShutdownTimeout)
+	if err != nil || c.shutdownTimeout <= 0 {
+		return fmt.Errorf("invalid ShutdownTimeout %q", c.ShutdownTimeout)
+	}
+	c.logLevel, err = logging.ParseLevel(c.LogLevel)
+	if err != nil {
+		return err
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("unknown log format %q", c.LogFormat)
+	}
+	return nil
+}
+
+// Block dumps are big, they need both DumpBlocks and the debug level
+func dumpBlocks() bool {
+	return conf.DumpBlocks && logger.Enabled(logging.LevelDebug)
+}
+
+func (c *Config) rpcConf() (*rpcclient.ConnConfig, error) {
+	user, pass, err := c.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	certs, err := c.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	return &rpcclient.ConnConfig{
+		Host:         c.Host,
+		User:         user,
+		Pass:         pass,
+		HTTPPostMode: true,
+		DisableTLS:   !c.TLS,
+		Certificates: certs,
+	}, nil
+}
+
+// Tells whether an OP_RETURN payload passes the prefix filter
+func (c *Config) wantMsg(msg []byte) bool {
+	if len(c.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if bytes.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
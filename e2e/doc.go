@@ -0,0 +1,7 @@
+// Package e2e drives the whole pipeline against a local regtest bitcoind:
+// the opreturn tool sends an OP_RETURN tx, bitcoind mines it, the watcher
+// publishes the block over ZMQ and the test receives it like client.go does.
+//
+// The tests are skipped when bitcoind/bitcoin-cli can't be found in $PATH
+// (or in $BITCOIND / $BITCOIN_CLI). regtest.sh runs the same steps by hand.
+package e2e
@@ -0,0 +1,64 @@
+#!/bin/sh
+# Runs the pipeline by hand against a throwaway regtest bitcoind:
+# bitcoind -> blocknotify -> watcher -> ZMQ -> client.
+#
+#   e2e/regtest.sh [message]
+#
+# Needs bitcoind, bitcoin-cli and curl in $PATH. Everything lives in a temp
+# dir that is removed on exit.
+set -e
+
+MSG=${1:-"hello regtest"}
+ROOT=$(cd "$(dirname "$0")/.." && pwd)
+DIR=$(mktemp -d)
+RPCPORT=${RPCPORT:-18443}
+CLI="bitcoin-cli -datadir=$DIR"
+
+cleanup() {
+	$CLI stop >/dev/null 2>&1 || true
+	[ -n "$WATCHER" ] && kill $WATCHER 2>/dev/null || true
+	[ -n "$CLIENT" ] && kill $CLIENT 2>/dev/null || true
+	sleep 1
+	rm -rf "$DIR"
+}
+trap cleanup EXIT
+
+cat > "$DIR/bitcoin.conf" <<CONF
+regtest=1
+server=1
+listen=0
+fallbackfee=0.0002
+rpcuser=e2e
+rpcpassword=e2epass
+blocknotify=curl -s http://127.0.0.1:8000/block
+[regtest]
+rpcport=$RPCPORT
+CONF
+
+cat > "$DIR/conf.json" <<CONF
+{"Host": "127.0.0.1:$RPCPORT", "User": "e2e", "Pass": "e2epass", "Network": "regtest", "FallbackFeeRate": 2}
+CONF
+
+echo "building into $DIR"
+(cd "$ROOT" && go build -o "$DIR/btcwatch" . && go build -o "$DIR/opreturn" ./opreturn && go build -o "$DIR/client" ./client)
+
+bitcoind -datadir="$DIR" -daemon
+$CLI -rpcwait getblockchaininfo >/dev/null
+
+$CLI createwallet e2e >/dev/null 2>&1 || true
+MINER=$($CLI getnewaddress "" legacy)
+DEST=$($CLI getnewaddress "" legacy)
+$CLI generatetoaddress 101 "$MINER" >/dev/null
+
+cd "$DIR"
+./btcwatch &
+WATCHER=$!
+./client -connect tcp://127.0.0.1:8001 &
+CLIENT=$!
+sleep 1
+
+./opreturn --network regtest --real --yes send "$DEST" 0.001 "$MSG"
+$CLI generatetoaddress 1 "$MINER" >/dev/null
+
+# Leave the client some time to print the published block
+sleep 3
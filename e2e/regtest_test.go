@@ -0,0 +1,208 @@
+package e2e
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/libreoscar/btcwatch/message"
+	zmq "github.com/pebbe/zmq4"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	rpcUser = "e2e"
+	rpcPass = "e2epass"
+)
+
+type regtest struct {
+	t       *testing.T
+	dir     string
+	rpcPort int
+	cli     string
+	daemon  *exec.Cmd
+}
+
+func lookBinary(env, name string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func startRegtest(t *testing.T, bitcoind, bitcoinCli string) *regtest {
+	dir, err := ioutil.TempDir("", "btcwatch-e2e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &regtest{t: t, dir: dir, rpcPort: freePort(t), cli: bitcoinCli}
+	conf := fmt.Sprintf("regtest=1\nserver=1\nlisten=0\nfallbackfee=0.0002\n"+
+		"rpcuser=%s\nrpcpassword=%s\n[regtest]\nrpcport=%d\n", rpcUser, rpcPass, r.rpcPort)
+	err = ioutil.WriteFile(filepath.Join(dir, "bitcoin.conf"), []byte(conf), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.daemon = exec.Command(bitcoind, "-datadir="+dir)
+	if err := r.daemon.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if _, err := r.call("getblockchaininfo"); err == nil {
+			break
+		} else if i == 100 {
+			r.stop()
+			t.Fatalf("bitcoind didn't come up: %s", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return r
+}
+
+func (r *regtest) call(args ...string) (string, error) {
+	out, err := exec.Command(r.cli, append([]string{"-datadir=" + r.dir}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("bitcoin-cli %s: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (r *regtest) mustCall(args ...string) string {
+	out, err := r.call(args...)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return out
+}
+
+func (r *regtest) stop() {
+	r.call("stop")
+	done := make(chan error, 1)
+	go func() { done <- r.daemon.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		r.daemon.Process.Kill()
+	}
+	os.RemoveAll(r.dir)
+}
+
+// Builds the watcher and the opreturn tool into dir
+func buildBinaries(t *testing.T, dir string) (watcher, opreturn string) {
+	watcher = filepath.Join(dir, "btcwatch")
+	opreturn = filepath.Join(dir, "opreturn")
+	for bin, pkg := range map[string]string{watcher: "..", opreturn: "../opreturn"} {
+		out, err := exec.Command("go", "build", "-o", bin, pkg).CombinedOutput()
+		if err != nil {
+			t.Fatalf("go build %s: %s: %s", pkg, err, out)
+		}
+	}
+	return
+}
+
+func TestOpReturnRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping regtest e2e in short mode")
+	}
+	bitcoind := lookBinary("BITCOIND", "bitcoind")
+	bitcoinCli := lookBinary("BITCOIN_CLI", "bitcoin-cli")
+	if bitcoind == "" || bitcoinCli == "" {
+		t.Skip("bitcoind/bitcoin-cli not found")
+	}
+
+	r := startRegtest(t, bitcoind, bitcoinCli)
+	defer r.stop()
+
+	// Fund a wallet: coinbase outputs need 100 confirmations
+	r.call("createwallet", "e2e")
+	minerAddr := r.mustCall("getnewaddress", "", "legacy")
+	r.mustCall("generatetoaddress", "101", minerAddr)
+	destAddr := r.mustCall("getnewaddress", "", "legacy")
+
+	// Both binaries share conf.json, the opreturn tool reads it from its
+	// working directory and ignores the watcher settings
+	work := filepath.Join(r.dir, "work")
+	os.Mkdir(work, 0700)
+	watcherHttp := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	watcherZmq := fmt.Sprintf("tcp://127.0.0.1:%d", freePort(t))
+	conf := fmt.Sprintf(`{"Host": "127.0.0.1:%d", "User": "%s", "Pass": "%s", "Network": "regtest",
+		"FallbackFeeRate": 2, "HttpListen": "%s", "Sinks": [{"Type": "zmq", "Address": "%s"}]}`,
+		r.rpcPort, rpcUser, rpcPass, watcherHttp, watcherZmq)
+	if err := ioutil.WriteFile(filepath.Join(work, "conf.json"), []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	watcherBin, opreturnBin := buildBinaries(t, work)
+
+	watcher := exec.Command(watcherBin, "-conf", filepath.Join(work, "conf.json"))
+	watcher.Dir = work
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Process.Kill()
+
+	receiver, err := zmq.NewSocket(zmq.SUB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	receiver.SetRcvtimeo(30 * time.Second)
+	receiver.SetSubscribe("")
+	if err := receiver.Connect(watcherZmq); err != nil {
+		t.Fatal(err)
+	}
+	// Give the subscription time to reach the publisher
+	time.Sleep(time.Second)
+
+	payload := fmt.Sprintf("btcwatch e2e %d", time.Now().Unix())
+	send := exec.Command(opreturnBin, "--network", "regtest", "--real", "--yes", "send", destAddr, "0.001", payload)
+	send.Dir = work
+	if out, err := send.CombinedOutput(); err != nil {
+		t.Fatalf("opreturn send: %s: %s", err, out)
+	}
+
+	r.mustCall("generatetoaddress", "1", minerAddr)
+	// Same request bitcoind's blocknotify makes in production
+	resp, err := http.Get("http://" + watcherHttp + "/block")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	data, err := receiver.RecvBytes(0)
+	if err != nil {
+		t.Fatalf("no block published: %s", err)
+	}
+	processedBlock := &message.ProcessedBlock{}
+	if err := proto.Unmarshal(data, processedBlock); err != nil {
+		t.Fatal(err)
+	}
+	if processedBlock.BlockIndex != 102 {
+		t.Errorf("published block %d, want 102", processedBlock.BlockIndex)
+	}
+	for _, tx := range processedBlock.Txs {
+		for _, result := range tx.Result {
+			if msg := result.GetMsg(); msg != nil && string(msg.Data) == payload && msg.Msg == payload {
+				return
+			}
+		}
+	}
+	t.Errorf("OP_RETURN %q not found in %v", payload, processedBlock)
+}
@@ -0,0 +1,92 @@
+// Package logging is the leveled, structured logger of both binaries. It
+// writes text or JSON records with key/value fields on top of log/slog.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Levels, from the most verbose. Crit sits above slog's error level.
+const (
+	LevelDebug = slog.LevelDebug
+	LevelInfo  = slog.LevelInfo
+	LevelWarn  = slog.LevelWarn
+	LevelError = slog.LevelError
+	LevelCrit  = slog.Level(12)
+)
+
+var levelNames = map[string]slog.Level{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+	"crit":  LevelCrit,
+}
+
+func ParseLevel(s string) (slog.Level, error) {
+	level, ok := levelNames[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+type Logger struct {
+	l *slog.Logger
+}
+
+// New returns a logger writing records at or above level to w, as JSON
+// objects when json is set
+func New(w io.Writer, level slog.Level, json bool) *Logger {
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				if l, ok := a.Value.Any().(slog.Level); ok && l >= LevelCrit {
+					a.Value = slog.StringValue("CRIT")
+				}
+			}
+			return a
+		},
+	}
+	var h slog.Handler
+	if json {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return &Logger{slog.New(h)}
+}
+
+// With returns a logger adding the key/value pairs to every record
+func (l *Logger) With(kv ...interface{}) *Logger {
+	return &Logger{l.l.With(kv...)}
+}
+
+func (l *Logger) Enabled(level slog.Level) bool {
+	return l.l.Enabled(context.Background(), level)
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.l.Log(context.Background(), LevelDebug, msg, kv...)
+}
+
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.l.Log(context.Background(), LevelInfo, msg, kv...)
+}
+
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.l.Log(context.Background(), LevelWarn, msg, kv...)
+}
+
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.l.Log(context.Background(), LevelError, msg, kv...)
+}
+
+func (l *Logger) Crit(msg string, kv ...interface{}) {
+	l.l.Log(context.Background(), LevelCrit, msg, kv...)
+}
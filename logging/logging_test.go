@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for name, level := range levelNames {
+		l, err := ParseLevel(strings.ToUpper(name))
+		if err != nil || l != level {
+			t.Error("ParseLevel failed", name)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel accepted verbose")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelInfo, true).With("component", "watcher")
+	logger.Debug("hidden")
+	logger.Info("block processed", "height", 420000, "txs", 3)
+	logger.Crit("rpc down")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatal("wrong records", lines)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["msg"] != "block processed" || rec["level"] != "INFO" || rec["height"] != 420000.0 ||
+		rec["txs"] != 3.0 || rec["component"] != "watcher" {
+		t.Error("wrong record", lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["level"] != "CRIT" {
+		t.Error("wrong crit level", lines[1])
+	}
+}
+
+func TestText(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, LevelWarn, false)
+	logger.Info("hidden")
+	logger.Warn("publish failed", "sink", "zmq:tcp://*:8001")
+	if !strings.Contains(buf.String(), `level=WARN msg="publish failed" sink=zmq:tcp://*:8001`) {
+		t.Error("wrong record", buf.String())
+	}
+	if logger.Enabled(LevelInfo) || !logger.Enabled(LevelCrit) {
+		t.Error("wrong Enabled")
+	}
+}
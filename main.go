@@ -3,89 +3,103 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"flag"
 	"fmt"
-	"github.com/btcsuite/btcrpcclient"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/btcsuite/btcutil"
+	"github.com/davecgh/go-spew/spew"
 	"github.com/golang/protobuf/proto"
 	"github.com/libreoscar/btcwatch/addr"
+	"github.com/libreoscar/btcwatch/braft"
+	"github.com/libreoscar/btcwatch/logging"
 	"github.com/libreoscar/btcwatch/message"
-	"github.com/davecgh/go-spew/spew"
-	"github.com/libreoscar/utils/log"
-	zmq "github.com/pebbe/zmq4"
+	"github.com/libreoscar/btcwatch/nulldata"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 )
 
-var client *btcrpcclient.Client
-var sender *zmq.Socket
-var logger = log.New(log.DEBUG)
-var isTestnet = false
-
-func loadConf() *btcrpcclient.ConnConfig {
-	file, err := os.Open("conf.json")
-	if err != nil {
-		logger.Crit("failed to open \"conf.json\"")
-		os.Exit(-1)
-	}
-	decoder := json.NewDecoder(file)
-	rpcConf := &btcrpcclient.ConnConfig{}
-	err = decoder.Decode(rpcConf)
-	if err != nil {
-		logger.Crit(fmt.Sprintf("decode error:%s", err.Error()))
-		os.Exit(-1)
-	}
-	logger.Info(fmt.Sprintf("is testnet:%v", isTestnet))
-	rpcConf.HTTPPostMode = true
-	rpcConf.DisableTLS = true
-	return rpcConf
-}
+var client *rpcclient.Client
+var sinks []sink
+var logger = logging.New(os.Stderr, logging.LevelDebug, false)
+var conf = defaultConfig()
+var queue = newBlockQueue()
+var netParams = &chaincfg.MainNetParams
 
-func getInfo(client *btcrpcclient.Client) {
+func getInfo(client *rpcclient.Client) {
 	// getinfo demo
 	info, err := client.GetInfo()
 	if err != nil {
 		logger.Crit(err.Error())
 	}
-	logger.Info(fmt.Sprintf("Bitcoind Info: %v", spew.Sdump(info)))
+	logger.Info("bitcoind info", "info", spew.Sdump(info))
 
 }
 
+// Returns the data pushed by a null data script, several pushes joined, nil
+// for other scripts
 func decodePkScript(script []byte) (message []byte) {
-	if len(script) < 3 || len(script) > 82 || script[0] != 0x6a {
+	pushes, err := nulldata.Parse(script)
+	if err != nil || len(pushes) == 0 {
 		return nil
-	} else {
-		size := int(script[1])
-		if size != len(script)-2 {
-			return nil
-		}
-		return script[2:]
 	}
+	return bytes.Join(pushes, nil)
 }
 
-func checkBlock(client *btcrpcclient.Client, blockNum int64) {
-	blockHash, err := client.GetBlockHash(blockNum)
-	if err != nil {
-		logger.Crit(err.Error())
-		return
+// A braft payload is published as a BraftTransfer, any other message, a
+// malformed braft one included, as is
+func msgResult(msg []byte) *message.TxResult {
+	// Subscribers of before BraftTransfer only read OpReturnMsg, where braft
+	// payloads went too
+	if !conf.LegacyMsgField {
+		transfer, err := braft.Decode(msg)
+		if err == nil {
+			return &message.TxResult{
+				Result: &message.TxResult_Braft{
+					Braft: &message.BraftTransfer{Version: uint32(transfer.Version), Receiver: transfer.Receiver},
+				},
+			}
+		}
+		if err != braft.ErrNotBraft {
+			logger.Debug("invalid braft payload, published as a message", "err", err)
+		}
 	}
-	block, err := client.GetBlock(blockHash)
+	return &message.TxResult{
+		Result: &message.TxResult_Msg{Msg: message.NewOpReturnMsg(msg, conf.LegacyMsgField)},
+	}
+}
+
+// Processes a block and publishes it. published holds the indexes of the
+// sinks that already got the block in an earlier attempt: they are skipped,
+// and the sinks that succeed now are added.
+func checkBlock(ctx context.Context, blockNum int64, blockHash *chainhash.Hash, published map[int]bool) error {
+	blockLog := logger.With("height", blockNum, "hash", blockHash.String())
+	block, err := getBlock(ctx, blockHash)
 	if err != nil {
-		logger.Crit(err.Error())
-		return
+		blockLog.Crit("getblock failed", "err", err)
+		return err
 	}
 
 	txs := block.Transactions()
 
 	var processedBlock = &message.ProcessedBlock{
-		int32(blockNum),
-		make([]*message.ProcessedTx, 0),
+		BlockIndex: int32(blockNum),
+		Txs:        make([]*message.ProcessedTx, 0),
 	}
+	// One slot per tx so the goroutines don't share a slice, compacted
+	// in block order afterwards
+	processedTxs := make([]*message.ProcessedTx, len(txs))
 
-	logger.Info("Processing txs...")
+	blockLog.Debug("processing txs", "txs", len(txs))
 	start := time.Now()
 	var wg sync.WaitGroup
 	for txIndex, tx := range txs {
@@ -96,96 +110,235 @@ func checkBlock(client *btcrpcclient.Client, blockNum int64) {
 			result := make([]*message.TxResult, len(vouts))
 			hasReturn := false
 			for i, vout := range vouts {
-				btcAddr := addr.NewAddrFromPkScript(vout.PkScript, isTestnet)
+				result[i] = &message.TxResult{}
+				btcAddr := addr.NewAddrFromPkScript(vout.PkScript, netParams)
 				if btcAddr != nil {
+					if conf.Filters.NoTransfers {
+						continue
+					}
 					result[i] = &message.TxResult{
-						&message.TxResult_Transfer{
-							&message.ValueTransfer{
-								btcAddr.String(),
-								uint64(vout.Value),
+						Result: &message.TxResult_Transfer{
+							Transfer: &message.ValueTransfer{
+								Address: btcAddr.String(),
+								Value:   uint64(vout.Value),
 							},
 						},
 					}
 				} else {
 					msg := decodePkScript(vout.PkScript)
-					if msg != nil {
-						result[i] = &message.TxResult{
-							&message.TxResult_Msg{
-								&message.OpReturnMsg{string(msg)},
-							},
-						}
+					if msg != nil && conf.wantMsg(msg) {
+						result[i] = msgResult(msg)
 						hasReturn = true
 					}
 				}
 			}
 			if hasReturn {
-				processedBlock.Txs = append(processedBlock.Txs,
-					&message.ProcessedTx{
-						tx.Sha().String(),
-						result,
-					})
+				processedTxs[txIndex] = &message.ProcessedTx{
+					Txid:   tx.Hash().String(),
+					Result: result,
+				}
 			}
 		}(txIndex, tx)
 	}
 	wg.Wait()
-	spew.Dump(processedBlock)
+	for _, processedTx := range processedTxs {
+		if processedTx != nil {
+			processedBlock.Txs = append(processedBlock.Txs, processedTx)
+		}
+	}
+	if dumpBlocks() {
+		blockLog.Debug("processed block", "dump", spew.Sdump(processedBlock))
+	}
+	if len(processedBlock.Txs) == 0 && conf.Filters.SkipEmpty {
+		blockLog.Info("no matching txs, skipped", "txs", len(txs), "duration", time.Since(start))
+		status.processed(blockNum, blockHash.String(), 0)
+		blocksProcessed.Inc()
+		lastHeight.Set(float64(blockNum))
+		return nil
+	}
 	data, err := proto.Marshal(processedBlock)
 	if err != nil {
-		logger.Crit(err.Error())
-	} else {
-		logger.Info("Publish to ZMQ...")
-		spew.Dump(data)
-		sender.SendBytes(data, 0)
+		blockLog.Crit("marshal failed", "err", err)
+		return err
+	}
+	if dumpBlocks() {
+		blockLog.Debug("publishing", "bytes", len(data), "dump", spew.Sdump(data))
+	}
+	var publishErr error
+	for i, s := range sinks {
+		if published[i] {
+			blockLog.Debug("already published, sink skipped", "sink", s.Name())
+			continue
+		}
+		err := s.Publish(data)
+		status.published(err)
+		observePublish(s, err)
+		if err != nil {
+			blockLog.Crit("publish failed", "sink", s.Name(), "err", err)
+			publishErr = fmt.Errorf("publish failed: %s", err)
+			continue
+		}
+		published[i] = true
 	}
 	elapsed := time.Since(start)
-	logger.Info(fmt.Sprintf("Process done in %s", elapsed))
-	logger.Info(fmt.Sprintf("Block %d has %d OP_Return Txs", blockNum, len(processedBlock.Txs)))
+	blockDuration.Observe(elapsed.Seconds())
+	blockLog.Info("block processed", "txs", len(txs), "opreturn_txs", len(processedBlock.Txs),
+		"bytes", len(data), "duration", elapsed)
+	if publishErr != nil {
+		return publishErr
+	}
+	status.processed(blockNum, blockHash.String(), len(processedBlock.Txs))
+	blocksProcessed.Inc()
+	opReturnTxs.Add(float64(len(processedBlock.Txs)))
+	lastHeight.Set(float64(blockNum))
+	return nil
 }
 
+// Called by bitcoind's blocknotify, the block itself is processed by the queue
 func blockNotify(w http.ResponseWriter, r *http.Request) {
-	logger.Info("Received new block!")
-	blockNum, err := client.GetBlockCount()
-	if err != nil {
-		io.WriteString(w, "bitcoind rpc failed\n")
+	logger.Debug("block notification", "remote", r.RemoteAddr)
+	if status.isShuttingDown() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
 	}
-	checkBlock(client, blockNum)
+	queue.notify()
+	w.WriteHeader(http.StatusAccepted)
+	io.WriteString(w, "queued\n")
 }
 
 func main() {
-	connCfg := loadConf()
-	var err error
+	os.Exit(run())
+}
+
+// Runs the watcher until SIGINT/SIGTERM or a server failure, returns the
+// exit status
+func run() int {
+	confPath := flag.String("conf", "conf.json", "path of the config file")
+	flag.Parse()
 
-	client, err = btcrpcclient.New(connCfg, nil)
+	var err error
+	conf, err = loadConf(*confPath)
 	if err != nil {
 		logger.Crit(err.Error())
-		return
+		return 1
+	}
+	logger = logging.New(os.Stderr, conf.logLevel, conf.LogFormat == "json")
+	netParams = conf.netParams
+	logger.Info("config loaded", "conf", *confPath, "network", netParams.Name)
+	if conf.LegacyMsgField {
+		logger.Warn("LegacyMsgField is deprecated and will be removed in v0.2.0, subscribers should read OpReturnMsg.data")
 	}
-	defer client.Shutdown()
 
-	var wg sync.WaitGroup
+	if conf.CheckpointFile != "" {
+		cp, err := loadCheckpoint(conf.CheckpointFile)
+		if err != nil {
+			logger.Crit("failed to load checkpoint", "err", err)
+			return 1
+		}
+		if cp != nil {
+			status.restore(cp)
+			logger.Info("resuming after checkpoint", "height", cp.Height, "hash", cp.Hash)
+		}
+	}
 
-	wg.Add(1)
+	if err := connect(); err != nil {
+		logger.Crit(err.Error())
+		return 1
+	}
+	defer func() { rpcClient().Shutdown() }()
+	rpc = newRPC()
 
-	http.HandleFunc("/block", blockNotify)
-	logger.Info("Starting server...")
+	// Start sinks (ZMQ server for braft, ...)
+	sinks, err = openSinks(conf.Sinks)
+	if err != nil {
+		logger.Crit(err.Error())
+		return 1
+	}
+	logger.Info("sinks started", "sinks", len(sinks))
 
-	// Start http server for bitcoind
+	mux := http.NewServeMux()
+	mux.HandleFunc("/block", blockNotify)
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", readyz)
+	mux.HandleFunc("/status", statusHandler)
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: conf.HttpListen, Handler: mux}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
 	go func() {
-		defer wg.Done()
-		err = http.ListenAndServe("127.0.0.1:8000", nil)
-		if err != nil {
-			logger.Crit(err.Error())
+		select {
+		case sig := <-signals:
+			logger.Info("shutting down", "signal", sig.String())
+			cancel()
+		case <-ctx.Done():
 		}
 	}()
 
-	// Start ZMQ server for braft
-	sender, err = zmq.NewSocket(zmq.PUB)
-	defer sender.Close()
-	if err != nil {
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	defer stopQueue()
+	go queue.run(queueCtx)
+	if status.checkpoint() != nil {
+		// Catch up with the blocks mined while we were down
+		queue.notify()
+	}
+
+	// Start http server for bitcoind
+	logger.Info("starting server", "listen", conf.HttpListen)
+	exitCode := 0
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serverErr:
 		logger.Crit(err.Error())
+		exitCode = 1
+	case <-ctx.Done():
 	}
-	sender.Bind("tcp://*:8001")
-	logger.Info("ZMQ server started...")
 
-	wg.Wait()
+	return shutdown(server, stopQueue, exitCode)
+}
+
+// Stops accepting notifications, lets the block in flight finish, then
+// flushes the sinks and persists the checkpoint. When the block doesn't
+// finish in time the sinks are left to the process exit.
+func shutdown(server *http.Server, stopQueue context.CancelFunc, exitCode int) int {
+	status.setShuttingDown()
+	ctx, cancel := context.WithTimeout(context.Background(), conf.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Crit("server shutdown failed", "err", err)
+		exitCode = 1
+	}
+	stopQueue()
+	if err := queue.wait(ctx); err != nil {
+		// A block is still being published: closing the sinks under it would
+		// race, and the checkpoint is saved after each block anyway
+		logger.Crit("block still in flight, exiting without closing the sinks", "err", err)
+		return 1
+	}
+
+	if !closeSinks(sinks) {
+		exitCode = 1
+	}
+	if err := persistCheckpoint(); err != nil {
+		logger.Crit("failed to save checkpoint", "err", err)
+		exitCode = 1
+	}
+	logger.Info("shutdown done", "exit", exitCode)
+	return exitCode
+}
+
+func persistCheckpoint() error {
+	if conf.CheckpointFile == "" {
+		return nil
+	}
+	if cp := status.checkpoint(); cp != nil {
+		return saveCheckpoint(conf.CheckpointFile, cp)
+	}
+	return nil
 }
@@ -0,0 +1,33 @@
+package message
+
+import (
+	"encoding/hex"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NewOpReturnMsg wraps an OP_RETURN payload, msg being set for text payloads
+// only. With legacy, for subscribers that only read msg, any other payload
+// goes there hex encoded: proto3 strings must be valid UTF-8, raw bytes
+// would make the whole block fail to marshal.
+func NewOpReturnMsg(data []byte, legacy bool) *OpReturnMsg {
+	msg := Text(data)
+	if msg == "" && legacy {
+		msg = hex.EncodeToString(data)
+	}
+	return &OpReturnMsg{Msg: msg, Data: data}
+}
+
+// Text returns data as a string when it is printable UTF-8, "" otherwise
+func Text(data []byte) string {
+	if !utf8.Valid(data) {
+		return ""
+	}
+	text := string(data)
+	for _, r := range text {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return ""
+		}
+	}
+	return text
+}
@@ -0,0 +1,48 @@
+package message
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/golang/protobuf/proto"
+	"github.com/libreoscar/btcwatch/braft"
+	"testing"
+)
+
+func TestNewOpReturnMsg(t *testing.T) {
+	braftPayload, err := braft.Encode(bytes.Repeat([]byte{0xfe}, braft.ReceiverSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte{0x00, 0xff, 0xc3, 0x28}
+	tests := []struct {
+		data   []byte
+		legacy bool
+		msg    string
+	}{
+		{[]byte("hello world"), false, "hello world"},
+		{[]byte("hello world"), true, "hello world"},
+		{binary, false, ""},
+		{binary, true, hex.EncodeToString(binary)},
+		{braftPayload, false, ""},
+		{braftPayload, true, hex.EncodeToString(braftPayload)},
+	}
+	for _, test := range tests {
+		block := &ProcessedBlock{Txs: []*ProcessedTx{{
+			Txid:   "00",
+			Result: []*TxResult{{Result: &TxResult_Msg{Msg: NewOpReturnMsg(test.data, test.legacy)}}},
+		}}}
+		data, err := proto.Marshal(block)
+		if err != nil {
+			t.Errorf("%x, legacy %v: %s", test.data, test.legacy, err)
+			continue
+		}
+		decoded := &ProcessedBlock{}
+		if err := proto.Unmarshal(data, decoded); err != nil {
+			t.Fatal(err)
+		}
+		got := decoded.Txs[0].Result[0].GetMsg()
+		if got.Msg != test.msg || !bytes.Equal(got.Data, test.data) {
+			t.Errorf("%x, legacy %v: got msg %q data %x", test.data, test.legacy, got.Msg, got.Data)
+		}
+	}
+}
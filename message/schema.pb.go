@@ -11,6 +11,7 @@ It is generated from these files:
 It has these top-level messages:
 	ValueTransfer
 	OpReturnMsg
+	BraftTransfer
 	TxResult
 	ProcessedTx
 	ProcessedBlock
@@ -41,7 +42,10 @@ func (*ValueTransfer) ProtoMessage()               {}
 func (*ValueTransfer) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
 type OpReturnMsg struct {
-	Msg string `protobuf:"bytes,1,opt,name=msg" json:"msg,omitempty"`
+	// The payload when it is printable UTF-8 text, empty otherwise (hex with
+	// LegacyMsgField)
+	Msg  string `protobuf:"bytes,1,opt,name=msg" json:"msg,omitempty"`
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
 }
 
 func (m *OpReturnMsg) Reset()                    { *m = OpReturnMsg{} }
@@ -49,17 +53,28 @@ func (m *OpReturnMsg) String() string            { return proto.CompactTextStrin
 func (*OpReturnMsg) ProtoMessage()               {}
 func (*OpReturnMsg) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
 
+type BraftTransfer struct {
+	Version  uint32 `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	Receiver []byte `protobuf:"bytes,2,opt,name=receiver,proto3" json:"receiver,omitempty"`
+}
+
+func (m *BraftTransfer) Reset()                    { *m = BraftTransfer{} }
+func (m *BraftTransfer) String() string            { return proto.CompactTextString(m) }
+func (*BraftTransfer) ProtoMessage()               {}
+func (*BraftTransfer) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
 type TxResult struct {
 	// Types that are valid to be assigned to Result:
 	//	*TxResult_Transfer
 	//	*TxResult_Msg
+	//	*TxResult_Braft
 	Result isTxResult_Result `protobuf_oneof:"Result"`
 }
 
 func (m *TxResult) Reset()                    { *m = TxResult{} }
 func (m *TxResult) String() string            { return proto.CompactTextString(m) }
 func (*TxResult) ProtoMessage()               {}
-func (*TxResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (*TxResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
 type isTxResult_Result interface {
 	isTxResult_Result()
@@ -71,9 +86,13 @@ type TxResult_Transfer struct {
 type TxResult_Msg struct {
 	Msg *OpReturnMsg `protobuf:"bytes,2,opt,name=msg,oneof"`
 }
+type TxResult_Braft struct {
+	Braft *BraftTransfer `protobuf:"bytes,3,opt,name=braft,oneof"`
+}
 
 func (*TxResult_Transfer) isTxResult_Result() {}
 func (*TxResult_Msg) isTxResult_Result()      {}
+func (*TxResult_Braft) isTxResult_Result()    {}
 
 func (m *TxResult) GetResult() isTxResult_Result {
 	if m != nil {
@@ -96,11 +115,19 @@ func (m *TxResult) GetMsg() *OpReturnMsg {
 	return nil
 }
 
+func (m *TxResult) GetBraft() *BraftTransfer {
+	if x, ok := m.GetResult().(*TxResult_Braft); ok {
+		return x.Braft
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*TxResult) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
 	return _TxResult_OneofMarshaler, _TxResult_OneofUnmarshaler, _TxResult_OneofSizer, []interface{}{
 		(*TxResult_Transfer)(nil),
 		(*TxResult_Msg)(nil),
+		(*TxResult_Braft)(nil),
 	}
 }
 
@@ -118,6 +145,11 @@ func _TxResult_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
 		if err := b.EncodeMessage(x.Msg); err != nil {
 			return err
 		}
+	case *TxResult_Braft:
+		b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Braft); err != nil {
+			return err
+		}
 	case nil:
 	default:
 		return fmt.Errorf("TxResult.Result has unexpected type %T", x)
@@ -144,6 +176,14 @@ func _TxResult_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffe
 		err := b.DecodeMessage(msg)
 		m.Result = &TxResult_Msg{msg}
 		return true, err
+	case 3: // Result.braft
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(BraftTransfer)
+		err := b.DecodeMessage(msg)
+		m.Result = &TxResult_Braft{msg}
+		return true, err
 	default:
 		return false, nil
 	}
@@ -163,6 +203,11 @@ func _TxResult_OneofSizer(msg proto.Message) (n int) {
 		n += proto.SizeVarint(2<<3 | proto.WireBytes)
 		n += proto.SizeVarint(uint64(s))
 		n += s
+	case *TxResult_Braft:
+		s := proto.Size(x.Braft)
+		n += proto.SizeVarint(3<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
 	case nil:
 	default:
 		panic(fmt.Sprintf("proto: unexpected type %T in oneof", x))
@@ -178,7 +223,7 @@ type ProcessedTx struct {
 func (m *ProcessedTx) Reset()                    { *m = ProcessedTx{} }
 func (m *ProcessedTx) String() string            { return proto.CompactTextString(m) }
 func (*ProcessedTx) ProtoMessage()               {}
-func (*ProcessedTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (*ProcessedTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
 
 func (m *ProcessedTx) GetResult() []*TxResult {
 	if m != nil {
@@ -195,7 +240,7 @@ type ProcessedBlock struct {
 func (m *ProcessedBlock) Reset()                    { *m = ProcessedBlock{} }
 func (m *ProcessedBlock) String() string            { return proto.CompactTextString(m) }
 func (*ProcessedBlock) ProtoMessage()               {}
-func (*ProcessedBlock) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*ProcessedBlock) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
 
 func (m *ProcessedBlock) GetTxs() []*ProcessedTx {
 	if m != nil {
@@ -207,28 +252,32 @@ func (m *ProcessedBlock) GetTxs() []*ProcessedTx {
 func init() {
 	proto.RegisterType((*ValueTransfer)(nil), "message.ValueTransfer")
 	proto.RegisterType((*OpReturnMsg)(nil), "message.OpReturnMsg")
+	proto.RegisterType((*BraftTransfer)(nil), "message.BraftTransfer")
 	proto.RegisterType((*TxResult)(nil), "message.TxResult")
 	proto.RegisterType((*ProcessedTx)(nil), "message.ProcessedTx")
 	proto.RegisterType((*ProcessedBlock)(nil), "message.ProcessedBlock")
 }
 
 var fileDescriptor0 = []byte{
-	// 271 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x54, 0x90, 0xbf, 0x4f, 0xf3, 0x30,
-	0x10, 0x86, 0xdb, 0xa6, 0x3f, 0xf2, 0x5d, 0xbe, 0x82, 0xb0, 0x10, 0xaa, 0x98, 0x20, 0x2c, 0x88,
-	0x21, 0x91, 0xe8, 0xce, 0xd0, 0x85, 0x32, 0x20, 0x50, 0x15, 0xb1, 0x3b, 0xf6, 0x91, 0x44, 0x24,
-	0x71, 0x65, 0x3b, 0xe0, 0x3f, 0x1f, 0xe3, 0xb8, 0xa1, 0x6c, 0xb6, 0xef, 0xf1, 0xf3, 0xbe, 0x3a,
-	0x58, 0x17, 0x95, 0x2e, 0xbb, 0x3c, 0x61, 0xa2, 0x49, 0xeb, 0x2a, 0x97, 0x28, 0x14, 0xa3, 0x32,
-	0xcd, 0x35, 0xfb, 0xa2, 0x9a, 0x95, 0x69, 0x83, 0x4a, 0xd1, 0x02, 0x53, 0xc5, 0x4a, 0x6c, 0x68,
-	0xb2, 0x97, 0x42, 0x0b, 0xb2, 0xf0, 0xaf, 0x71, 0x0a, 0xcb, 0x37, 0x5a, 0x77, 0x98, 0x49, 0xda,
-	0xaa, 0x77, 0x94, 0xe4, 0x14, 0x16, 0x94, 0x73, 0x69, 0xc7, 0xab, 0xf1, 0xd5, 0xf8, 0xf6, 0x1f,
-	0x59, 0xc2, 0xec, 0xf3, 0x87, 0x58, 0x4d, 0xec, 0x75, 0x1a, 0x5f, 0x42, 0xf4, 0xb2, 0xdf, 0xa1,
-	0xee, 0x64, 0xfb, 0xac, 0x0a, 0x12, 0x41, 0xd0, 0xa8, 0xa2, 0x47, 0x63, 0x84, 0x30, 0x33, 0x3b,
-	0x54, 0x5d, 0xad, 0xc9, 0x1d, 0x84, 0xda, 0x3b, 0xdd, 0x34, 0xba, 0xbf, 0x48, 0x7c, 0x68, 0xf2,
-	0x27, 0x71, 0x3b, 0x22, 0x37, 0xbd, 0x64, 0xe2, 0xb0, 0xf3, 0x01, 0x3b, 0xca, 0xd9, 0x8e, 0x36,
-	0x21, 0xcc, 0x7b, 0x75, 0xfc, 0x00, 0xd1, 0xab, 0x14, 0xcc, 0x52, 0xc8, 0x33, 0x43, 0xfe, 0xc3,
-	0x34, 0x33, 0x15, 0xf7, 0x75, 0xaf, 0x0f, 0x98, 0xd5, 0x05, 0x56, 0x77, 0x36, 0xe8, 0x0e, 0xd5,
-	0xe2, 0x47, 0x38, 0x19, 0xfe, 0x6f, 0x6a, 0xc1, 0x3e, 0x08, 0x01, 0x70, 0x87, 0xa7, 0x96, 0xa3,
-	0x71, 0xa2, 0x99, 0x15, 0x05, 0x99, 0x51, 0xde, 0xf2, 0x5b, 0xea, 0x28, 0x39, 0x9f, 0xbb, 0x65,
-	0xae, 0xbf, 0x03, 0x00, 0x00, 0xff, 0xff, 0x6d, 0xda, 0xdd, 0x2f, 0x83, 0x01, 0x00, 0x00,
+	// 319 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x91, 0xcb, 0x6e, 0xea, 0x30,
+	0x14, 0x45, 0x09, 0xe1, 0x91, 0x7b, 0x42, 0xee, 0xc3, 0xba, 0xaa, 0x32, 0x84, 0x74, 0xd0, 0xa8,
+	0x83, 0x44, 0x82, 0x79, 0x07, 0x4c, 0x4a, 0x07, 0x55, 0x2b, 0x14, 0x75, 0xee, 0x38, 0x87, 0x10,
+	0x35, 0x0f, 0xe4, 0xe3, 0xd0, 0x7c, 0x45, 0xbf, 0xb9, 0xc2, 0x18, 0x0a, 0x9d, 0x59, 0xd6, 0xda,
+	0xdb, 0x6b, 0xcb, 0xb0, 0xc8, 0x0b, 0xb5, 0x6d, 0xd3, 0x48, 0x34, 0x55, 0x5c, 0x16, 0xa9, 0xc4,
+	0x86, 0x04, 0x97, 0x71, 0xaa, 0xc4, 0x07, 0x57, 0x62, 0x1b, 0x57, 0x48, 0xc4, 0x73, 0x8c, 0x49,
+	0x6c, 0xb1, 0xe2, 0xd1, 0x4e, 0x36, 0xaa, 0x61, 0x63, 0x73, 0x1b, 0xc4, 0xe0, 0xbd, 0xf1, 0xb2,
+	0xc5, 0x44, 0xf2, 0x9a, 0x36, 0x28, 0xd9, 0x1f, 0x18, 0xf3, 0x2c, 0x93, 0x48, 0xe4, 0x5b, 0x53,
+	0x2b, 0xfc, 0xc5, 0x3c, 0x18, 0xee, 0x0f, 0x84, 0xdf, 0x9f, 0x5a, 0xe1, 0x20, 0x08, 0xc1, 0x7d,
+	0xd9, 0xad, 0x51, 0xb5, 0xb2, 0x7e, 0xa6, 0x9c, 0xb9, 0x60, 0x57, 0x94, 0x1b, 0x74, 0x02, 0x83,
+	0x8c, 0x2b, 0xae, 0xc9, 0x49, 0x30, 0x07, 0x6f, 0x29, 0xf9, 0x46, 0x5d, 0x56, 0xef, 0x51, 0x52,
+	0xd1, 0xd4, 0x9a, 0xf7, 0xd8, 0x5f, 0x70, 0x24, 0x0a, 0x2c, 0xf6, 0x28, 0x4d, 0xe6, 0xd3, 0x02,
+	0x27, 0xe9, 0xd6, 0x48, 0x6d, 0xa9, 0xd8, 0x3d, 0x38, 0xca, 0x64, 0x75, 0xc0, 0x9d, 0xdf, 0x44,
+	0xc6, 0x3b, 0xba, 0x92, 0x5e, 0xf5, 0xd8, 0xed, 0xd1, 0xa3, 0xaf, 0xb1, 0xff, 0x67, 0xec, 0x42,
+	0x75, 0xd5, 0x63, 0x77, 0x30, 0x4c, 0x0f, 0x46, 0xbe, 0xfd, 0xa3, 0xed, 0xca, 0x73, 0xd5, 0x5b,
+	0x3a, 0x30, 0x3a, 0x3a, 0x04, 0x0f, 0xe0, 0xbe, 0xca, 0x46, 0x20, 0x11, 0x66, 0x49, 0x77, 0x58,
+	0x98, 0x74, 0x45, 0x66, 0xf6, 0xce, 0x4e, 0x98, 0xdf, 0x9f, 0xda, 0xa1, 0x3b, 0xff, 0x77, 0x2e,
+	0x3c, 0x6d, 0x08, 0x1e, 0xe1, 0xf7, 0x39, 0xbf, 0x2c, 0x1b, 0xf1, 0xce, 0x18, 0x80, 0x3e, 0x3c,
+	0xd5, 0x19, 0x76, 0xba, 0x68, 0xc8, 0x66, 0x60, 0x27, 0x1d, 0x99, 0x96, 0x6f, 0xfb, 0x8b, 0x97,
+	0xd3, 0x91, 0xfe, 0xb8, 0xc5, 0xd7, 0x00, 0x10, 0x2e, 0x86, 0x1c, 0xef, 0x01, 0x00, 0x00,
 }
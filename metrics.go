@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Prometheus metrics, served on /metrics
+var (
+	blockDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "btcwatch",
+		Name:      "block_processing_seconds",
+		Help:      "Time spent decoding and publishing a block.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+	blocksProcessed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "btcwatch",
+		Name:      "blocks_processed_total",
+		Help:      "Blocks decoded and published to every sink.",
+	})
+	opReturnTxs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "btcwatch",
+		Name:      "opreturn_txs_total",
+		Help:      "Txs with a matching OP_RETURN output found in processed blocks.",
+	})
+	lastHeight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "btcwatch",
+		Name:      "last_processed_height",
+		Help:      "Height of the last processed block.",
+	})
+	nodeTip = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "btcwatch",
+		Name:      "node_tip_height",
+		Help:      "Block count last reported by bitcoind.",
+	})
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "btcwatch",
+		Name:      "rpc_duration_seconds",
+		Help:      "Duration of bitcoind RPC calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	rpcErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "btcwatch",
+		Name:      "rpc_errors_total",
+		Help:      "Failed bitcoind RPC calls.",
+	}, []string{"method"})
+	published = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "btcwatch",
+		Name:      "published_total",
+		Help:      "Blocks sent to a sink.",
+	}, []string{"sink"})
+	publishErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "btcwatch",
+		Name:      "publish_errors_total",
+		Help:      "Failed sends to a sink.",
+	}, []string{"sink"})
+)
+
+func init() {
+	prometheus.MustRegister(blockDuration, blocksProcessed, opReturnTxs, lastHeight, nodeTip,
+		rpcDuration, rpcErrors, published, publishErrors)
+}
+
+// Records a bitcoind RPC call started at start
+func observeRPC(method string, start time.Time, err error) {
+	rpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		rpcErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func observePublish(s sink, err error) {
+	if err != nil {
+		publishErrors.WithLabelValues(s.Name()).Inc()
+	} else {
+		published.WithLabelValues(s.Name()).Inc()
+	}
+}
@@ -0,0 +1,87 @@
+// Package netparams maps the network names used in conf.json and on the
+// command line to chaincfg parameters.
+package netparams
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"hash/fnv"
+	"strings"
+)
+
+// Custom describes a network chaincfg doesn't know about, e.g. a private
+// signet. It starts from the Base network and overrides every non-zero field.
+// Net is the network magic the parameters are registered under; when zero it
+// is derived from the name, so it never clashes with the base network.
+type Custom struct {
+	Base             string
+	Name             string
+	Net              uint32
+	PubKeyHashAddrID byte
+	ScriptHashAddrID byte
+	PrivateKeyID     byte
+	Bech32HRPSegwit  string
+}
+
+// Lookup returns the parameters for a network name. An empty name selects
+// mainnet, "custom" builds the parameters from custom.
+func Lookup(name string, custom *Custom) (*chaincfg.Params, error) {
+	switch strings.ToLower(name) {
+	case "", "main", "mainnet":
+		return &chaincfg.MainNetParams, nil
+	case "test", "testnet", "testnet3":
+		return &chaincfg.TestNet3Params, nil
+	case "regtest":
+		return &chaincfg.RegressionNetParams, nil
+	case "signet":
+		return &chaincfg.SigNetParams, nil
+	case "simnet":
+		return &chaincfg.SimNetParams, nil
+	case "custom":
+		if custom == nil {
+			return nil, fmt.Errorf("network \"custom\" needs custom network params")
+		}
+		return custom.Params()
+	}
+	return nil, fmt.Errorf("unknown network %q", name)
+}
+
+// Params builds the chaincfg parameters of the custom network.
+func (c *Custom) Params() (*chaincfg.Params, error) {
+	if strings.ToLower(c.Base) == "custom" {
+		return nil, fmt.Errorf("custom network can't be based on itself")
+	}
+	base, err := Lookup(c.Base, nil)
+	if err != nil {
+		return nil, err
+	}
+	params := *base
+	if c.Name != "" {
+		params.Name = c.Name
+	}
+	if c.PubKeyHashAddrID != 0 {
+		params.PubKeyHashAddrID = c.PubKeyHashAddrID
+	}
+	if c.ScriptHashAddrID != 0 {
+		params.ScriptHashAddrID = c.ScriptHashAddrID
+	}
+	if c.PrivateKeyID != 0 {
+		params.PrivateKeyID = c.PrivateKeyID
+	}
+	if c.Bech32HRPSegwit != "" {
+		params.Bech32HRPSegwit = strings.ToLower(c.Bech32HRPSegwit)
+	}
+	params.Net = wire.BitcoinNet(c.Net)
+	if c.Net == 0 {
+		h := fnv.New32a()
+		h.Write([]byte("custom:" + params.Name))
+		params.Net = wire.BitcoinNet(h.Sum32())
+	}
+	// btcutil only decodes addresses of registered networks. Building the
+	// same network twice registers it once.
+	if err := chaincfg.Register(&params); err != nil && err != chaincfg.ErrDuplicateNet {
+		return nil, fmt.Errorf("register custom network: %v", err)
+	}
+	return &params, nil
+}
@@ -0,0 +1,42 @@
+package netparams
+
+import (
+	"bytes"
+	"github.com/btcsuite/btcutil"
+	"testing"
+)
+
+func TestCustomAddress(t *testing.T) {
+	custom := &Custom{Base: "regtest", Name: "testcustom", PubKeyHashAddrID: 0x1e, Bech32HRPSegwit: "tcus"}
+	params, err := Lookup("custom", custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second build must not fail on the already registered network.
+	if _, err = custom.Params(); err != nil {
+		t.Fatal(err)
+	}
+	hash := bytes.Repeat([]byte{0x42}, 20)
+
+	wpkh, err := btcutil.NewAddressWitnessPubKeyHash(hash, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkh, err := btcutil.NewAddressPubKeyHash(hash, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []btcutil.Address{wpkh, pkh} {
+		s := a.EncodeAddress()
+		d, err := btcutil.DecodeAddress(s, params)
+		if err != nil {
+			t.Fatalf("decode %s: %v", s, err)
+		}
+		if !d.IsForNet(params) || d.EncodeAddress() != s {
+			t.Errorf("%s decoded as %s", s, d.EncodeAddress())
+		}
+	}
+	if s := wpkh.EncodeAddress(); s[:5] != "tcus1" {
+		t.Errorf("unexpected segwit address %s", s)
+	}
+}
@@ -0,0 +1,140 @@
+// Package nulldata builds and parses the OP_RETURN (null data) output
+// scripts carrying our messages, and checks them against the relay policy
+// of Bitcoin Core.
+package nulldata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	opReturn    = 0x6a
+	op0         = 0x00
+	opPushData1 = 0x4c
+	opPushData2 = 0x4d
+	opPushData4 = 0x4e
+	op1Negate   = 0x4f
+	op1         = 0x51
+	op16        = 0x60
+
+	// Consensus limit of a single push
+	MaxPushSize = 520
+)
+
+// Bitcoin Core's default -datacarriersize: the whole script, so 80 bytes of
+// data in a single push
+const DefaultDataCarrierSize = 83
+
+var ErrNotNullData = errors.New("not a null data script")
+
+// Script returns OP_RETURN followed by one push per element of pushes, each
+// with the smallest push opcode, as Bitcoin Core requires for relay
+func Script(pushes ...[]byte) ([]byte, error) {
+	script := []byte{opReturn}
+	for i, data := range pushes {
+		n := len(data)
+		switch {
+		case n > MaxPushSize:
+			return nil, fmt.Errorf("push %d is %d bytes, more than %d", i, n, MaxPushSize)
+		case n == 0:
+			script = append(script, op0)
+		case n == 1 && data[0] >= 1 && data[0] <= 16:
+			script = append(script, op1-1+data[0])
+		case n == 1 && data[0] == 0x81:
+			script = append(script, op1Negate)
+		case n < opPushData1:
+			script = append(script, byte(n))
+			script = append(script, data...)
+		case n <= 0xff:
+			script = append(script, opPushData1, byte(n))
+			script = append(script, data...)
+		default:
+			script = append(script, opPushData2, byte(n), byte(n>>8))
+			script = append(script, data...)
+		}
+	}
+	return script, nil
+}
+
+// Parse returns the data pushed by a null data script. Small integer opcodes
+// give the byte they push.
+func Parse(script []byte) ([][]byte, error) {
+	if len(script) == 0 || script[0] != opReturn {
+		return nil, ErrNotNullData
+	}
+	pushes := [][]byte{}
+	for i := 1; i < len(script); {
+		op := script[i]
+		i++
+		var n int
+		switch {
+		case op == op0:
+			pushes = append(pushes, []byte{})
+			continue
+		case op >= op1 && op <= op16:
+			pushes = append(pushes, []byte{op - op1 + 1})
+			continue
+		case op == op1Negate:
+			pushes = append(pushes, []byte{0x81})
+			continue
+		case op < opPushData1:
+			n = int(op)
+		case op == opPushData1 && i+1 <= len(script):
+			n = int(script[i])
+			i++
+		case op == opPushData2 && i+2 <= len(script):
+			n = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		case op == opPushData4 && i+4 <= len(script):
+			n = int(binary.LittleEndian.Uint32(script[i:]))
+			i += 4
+		default:
+			return nil, fmt.Errorf("%s: opcode 0x%02x at %d", ErrNotNullData, op, i-1)
+		}
+		if n < 0 || n > len(script)-i {
+			return nil, fmt.Errorf("%s: push of %d bytes past the end", ErrNotNullData, n)
+		}
+		pushes = append(pushes, script[i:i+n])
+		i += n
+	}
+	return pushes, nil
+}
+
+// CheckPolicy tells whether nodes running with dataCarrierSize as
+// -datacarriersize relay a tx with script as its null data output
+func CheckPolicy(script []byte, dataCarrierSize int) error {
+	if _, err := Parse(script); err != nil {
+		return err
+	}
+	if len(script) > dataCarrierSize {
+		return fmt.Errorf("null data script is %d bytes, -datacarriersize allows %d", len(script), dataCarrierSize)
+	}
+	return nil
+}
+
+// MaxSinglePush returns the largest message fitting in one push under
+// dataCarrierSize
+func MaxSinglePush(dataCarrierSize int) int {
+	n := dataCarrierSize
+	if n > MaxPushSize {
+		n = MaxPushSize
+	}
+	for ; n > 0; n-- {
+		if 1+pushHeaderSize(n)+n <= dataCarrierSize {
+			return n
+		}
+	}
+	return 0
+}
+
+func pushHeaderSize(n int) int {
+	switch {
+	case n < opPushData1:
+		return 1
+	case n <= 0xff:
+		return 2
+	}
+	return 3
+}
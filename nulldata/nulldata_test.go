@@ -0,0 +1,106 @@
+package nulldata
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	// Known-good scripts, as built by Bitcoin Core's CScript and btcd's
+	// txscript.ScriptBuilder
+	var tests = []struct {
+		name   string
+		pushes [][]byte
+		script string
+	}{
+		{"bare", nil, "6a"},
+		{"empty push", [][]byte{{}}, "6a00"},
+		{"small int", [][]byte{{1}, {16}}, "6a5160"},
+		{"1negate", [][]byte{{0x81}}, "6a4f"},
+		{"zero byte", [][]byte{{0}}, "6a0100"},
+		{"text", [][]byte{[]byte("hello")}, "6a0568656c6c6f"},
+		{"75 bytes", [][]byte{bytes.Repeat([]byte{0xaa}, 75)}, "6a4b" + strings.Repeat("aa", 75)},
+		{"76 bytes", [][]byte{bytes.Repeat([]byte{0xaa}, 76)}, "6a4c4c" + strings.Repeat("aa", 76)},
+		{"255 bytes", [][]byte{bytes.Repeat([]byte{0xaa}, 255)}, "6a4cff" + strings.Repeat("aa", 255)},
+		{"256 bytes", [][]byte{bytes.Repeat([]byte{0xaa}, 256)}, "6a4d0001" + strings.Repeat("aa", 256)},
+		{"520 bytes", [][]byte{bytes.Repeat([]byte{0xaa}, 520)}, "6a4d0802" + strings.Repeat("aa", 520)},
+		{"braft", [][]byte{[]byte("braft"), {1}, {0xde, 0xad}}, "6a0562726166745102dead"},
+	}
+	for _, test := range tests {
+		script, err := Script(test.pushes...)
+		if err != nil {
+			t.Error(test.name, err)
+			continue
+		}
+		if hex.EncodeToString(script) != test.script {
+			t.Error(test.name, "script", hex.EncodeToString(script))
+		}
+		pushes, err := Parse(script)
+		if err != nil || len(pushes) != len(test.pushes) {
+			t.Error(test.name, "parse", pushes, err)
+			continue
+		}
+		for i := range pushes {
+			if !bytes.Equal(pushes[i], test.pushes[i]) {
+				t.Error(test.name, "push", i, pushes[i])
+			}
+		}
+	}
+	if _, err := Script(make([]byte, 521)); err == nil {
+		t.Error("Script accepted a 521 bytes push")
+	}
+}
+
+func TestParse(t *testing.T) {
+	// OP_PUSHDATA4 isn't minimal, but it is still a push
+	pushes, err := Parse([]byte{0x6a, 0x4e, 2, 0, 0, 0, 0xbe, 0xef})
+	if err != nil || len(pushes) != 1 || hex.EncodeToString(pushes[0]) != "beef" {
+		t.Error("wrong pushdata4", pushes, err)
+	}
+	for _, bad := range []string{
+		"",
+		"76a914751e76e8199196d454941c45d1b3a323f1433bd688ac", // p2pkh
+		"6a05aabb",   // push past the end
+		"6a4c",       // truncated pushdata1
+		"6a4d01",     // truncated pushdata2
+		"6a0100ac",   // OP_CHECKSIG isn't a push
+		"6a4c05aabb", // pushdata1 past the end
+	} {
+		script, _ := hex.DecodeString(bad)
+		if pushes, err := Parse(script); err == nil {
+			t.Error("parsed", bad, pushes)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	max := MaxSinglePush(DefaultDataCarrierSize)
+	if max != 80 {
+		t.Error("wrong max push", max)
+	}
+	script, _ := Script(make([]byte, max))
+	if err := CheckPolicy(script, DefaultDataCarrierSize); err != nil {
+		t.Error(err)
+	}
+	script, _ = Script(make([]byte, max+1))
+	if err := CheckPolicy(script, DefaultDataCarrierSize); err == nil {
+		t.Error("81 bytes relayed")
+	}
+	// Two pushes share the limit
+	script, _ = Script(make([]byte, 40), make([]byte, 40))
+	if err := CheckPolicy(script, DefaultDataCarrierSize); err != nil {
+		t.Error(err)
+	}
+	script, _ = Script(make([]byte, 40), make([]byte, 41))
+	if err := CheckPolicy(script, DefaultDataCarrierSize); err == nil {
+		t.Error("84 bytes script relayed")
+	}
+	if MaxSinglePush(77) != 75 || MaxSinglePush(78) != 75 || MaxSinglePush(79) != 76 || MaxSinglePush(2) != 0 {
+		t.Error("wrong max push around the pushdata1 boundary")
+	}
+	if MaxSinglePush(100000) != MaxPushSize {
+		t.Error("max push above the consensus limit")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/libreoscar/btcwatch/batch"
+	"io/ioutil"
+	"os"
+)
+
+// What the txs sent by this run spent and created, so the next tx of a batch
+// can spend their change before it confirms
+var (
+	sentTxids      = make(map[string]bool)
+	spentOutpoints = make(map[string]bool)
+	// Change of the sent txs, only needed with a local key: the wallet
+	// already lists it
+	pendingChange []btcjson.ListUnspentResult
+)
+
+func outpoint(txid string, vout uint32) string {
+	return fmt.Sprintf("%s:%d", txid, vout)
+}
+
+func trackSent(txid string, inputs *selectInputsResult, tx *wire.MsgTx, changeIndex int) {
+	sentTxids[txid] = true
+	for _, input := range inputs.inputs {
+		spentOutpoints[outpoint(input.TxID, input.Vout)] = true
+	}
+	// Change to conf.json's ChangeAddress isn't the local key's to spend
+	if localKey == nil || conf.ChangeAddress != "" || changeIndex < 0 {
+		return
+	}
+	change := tx.TxOut[changeIndex]
+	pendingChange = append(pendingChange, btcjson.ListUnspentResult{
+		TxID:         txid,
+		Vout:         uint32(changeIndex),
+		Address:      localAddr.EncodeAddress(),
+		ScriptPubKey: hex.EncodeToString(change.PkScript),
+		Amount:       btcutil.Amount(change.Value).ToBTC(),
+		Spendable:    true,
+	})
+}
+
+// Sends the rows of path, one tx per row each spending the change of the
+// previous one in "chain" mode, or a single tx paying every row in "multi"
+// mode. Returns false when a row failed.
+func sendBatch(path, mode, reportPath string) bool {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Crit(err.Error())
+		return false
+	}
+	rows, err := batch.Parse(path, data)
+	if err != nil {
+		logger.Crit(err.Error())
+		return false
+	}
+	results, amounts, err := batch.Check(rows, mode)
+	if err != nil {
+		logger.Crit(err.Error(), "file", path)
+		return false
+	}
+
+	recipients := make([]recipient, len(rows))
+	pushes := make([][]byte, len(rows))
+	valid := true
+	for i, row := range rows {
+		recipients[i] = recipient{row.Address, amounts[i]}
+		pushes[i] = []byte(row.Message)
+		valid = valid && results[i].Error == ""
+	}
+
+	switch {
+	case mode == batch.Multi && !valid:
+		// Check failed every row
+	case mode == batch.Multi:
+		txid, err := sendOpReturn(recipients, pushes)
+		for i := range results {
+			results[i].Txid = txid
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}
+	case mode == batch.Chain:
+		for i := range rows {
+			if results[i].Error != "" {
+				continue
+			}
+			logger.Info("sending batch row", "row", i+1, "addr", recipients[i].addr, "amount", recipients[i].amount.String())
+			txid, err := sendOpReturn(recipients[i:i+1], pushes[i:i+1])
+			results[i].Txid = txid
+			if err != nil {
+				results[i].Error = err.Error()
+				logger.Error("batch row failed", "row", i+1, "err", err)
+			}
+		}
+	}
+
+	ok := true
+	fmt.Println("Batch report")
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			ok = false
+			fmt.Printf("  row %d  %s  %s  FAILED: %s\n", r.Row, r.Address, r.Amount, r.Error)
+		case r.Txid != "":
+			fmt.Printf("  row %d  %s  %s  %s\n", r.Row, r.Address, r.Amount, r.Txid)
+		default:
+			fmt.Printf("  row %d  %s  %s  not sent\n", r.Row, r.Address, r.Amount)
+		}
+	}
+	if reportPath != "" {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		if err := ioutil.WriteFile(reportPath, append(data, '\n'), 0644); err != nil {
+			logger.Crit("could not write the report", "file", reportPath, "err", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Exit status of sendbatch, so cron jobs notice failed rows
+func exitBatch(ok bool) {
+	if !ok {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/libreoscar/btcwatch/addr"
+	"github.com/libreoscar/btcwatch/txbuild"
+	"os"
+)
+
+// What bump needs of getmempoolentry. The descendants include the tx.
+type mempoolEntry struct {
+	VSize           int64 `json:"vsize"`
+	DescendantCount int64 `json:"descendantcount"`
+	Fees            struct {
+		Base       float64 `json:"base"`
+		Descendant float64 `json:"descendant"`
+	} `json:"fees"`
+}
+
+func getMempoolEntry(txid string) (*mempoolEntry, error) {
+	param, _ := json.Marshal(txid)
+	raw, err := retry0("getmempoolentry", func() (json.RawMessage, error) {
+		return client.RawRequest("getmempoolentry", []json.RawMessage{param})
+	})
+	if err != nil {
+		return nil, err
+	}
+	entry := &mempoolEntry{}
+	return entry, json.Unmarshal(raw, entry)
+}
+
+// Returns the output spent by an input of a mempool tx: from the UTXO set
+// when confirmed, from its parent in the mempool otherwise
+func prevOut(op wire.OutPoint) (*wire.TxOut, error) {
+	params := []json.RawMessage{json.RawMessage(`"` + op.Hash.String() + `"`),
+		json.RawMessage(fmt.Sprint(op.Index)), json.RawMessage("false")}
+	raw, err := retry0("gettxout", func() (json.RawMessage, error) {
+		return client.RawRequest("gettxout", params)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var utxo *struct {
+		Value        float64 `json:"value"`
+		ScriptPubKey struct {
+			Hex string `json:"hex"`
+		} `json:"scriptPubKey"`
+	}
+	if err := json.Unmarshal(raw, &utxo); err != nil {
+		return nil, err
+	}
+	if utxo != nil {
+		amount, err := btcutil.NewAmount(utxo.Value)
+		if err != nil {
+			return nil, err
+		}
+		script, err := hex.DecodeString(utxo.ScriptPubKey.Hex)
+		return wire.NewTxOut(int64(amount), script), err
+	}
+	result, err := getRawTransaction(op.Hash.String(), "")
+	if err != nil {
+		return nil, err
+	}
+	parent, err := result.tx()
+	if err != nil {
+		return nil, err
+	}
+	if int(op.Index) >= len(parent.TxOut) {
+		return nil, fmt.Errorf("%s has no output %d", op.Hash, op.Index)
+	}
+	return parent.TxOut[op.Index], nil
+}
+
+// Whether pkScript is change the tool sent: to conf.json's ChangeAddress or
+// the local key when set, which sendOpReturn never pays, else to an address
+// the wallet handed out for change. An output merely ours can be a payment.
+func isChange(pkScript []byte) bool {
+	if conf.ChangeAddress != "" || localKey != nil {
+		changeAddr, err := changeAddress()
+		if err != nil {
+			return false
+		}
+		script, err := changePkScript(changeAddr)
+		return err == nil && bytes.Equal(script, pkScript)
+	}
+	btcAddr := addr.NewAddrFromPkScript(pkScript, netParams)
+	if btcAddr == nil {
+		return false
+	}
+	info, err := getAddressInfo(btcAddr.String())
+	return err == nil && info.IsChange
+}
+
+// An unconfirmed tx of ours and what it pays. descendants are the mempool
+// txs spending it, which a replacement evicts, and descendantFees their fees
+// and its own.
+type stuckTx struct {
+	txid           string
+	tx             *wire.MsgTx
+	fee            btcutil.Amount
+	vsize          int64
+	changeIndex    int
+	descendants    int64
+	descendantFees btcutil.Amount
+}
+
+func getStuckTx(txid string) (*stuckTx, error) {
+	result, err := getRawTransaction(txid, "")
+	if err != nil {
+		return nil, err
+	}
+	if result.BlockHash != "" {
+		return nil, fmt.Errorf("%s is already confirmed, in block %s", txid, result.BlockHash)
+	}
+	tx, err := result.tx()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := getMempoolEntry(txid)
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't in the mempool: %s", txid, err)
+	}
+	fee, err := btcutil.NewAmount(entry.Fees.Base)
+	if err != nil {
+		return nil, err
+	}
+	descendantFees, err := btcutil.NewAmount(entry.Fees.Descendant)
+	if err != nil {
+		return nil, err
+	}
+	changeIndex, err := txbuild.FindChange(tx, isChange)
+	if err != nil {
+		return nil, fmt.Errorf("%s: can't tell its change: %s", txid, err)
+	}
+	if changeIndex < 0 {
+		return nil, fmt.Errorf("%s has no change output to take the fee from", txid)
+	}
+	return &stuckTx{txid, tx, fee, entry.VSize, changeIndex, entry.DescendantCount - 1, descendantFees}, nil
+}
+
+// The input spending op, as selectInputs would have returned it
+func unspentOf(op wire.OutPoint, out *wire.TxOut) btcjson.ListUnspentResult {
+	u := btcjson.ListUnspentResult{
+		TxID:         op.Hash.String(),
+		Vout:         op.Index,
+		ScriptPubKey: hex.EncodeToString(out.PkScript),
+		Amount:       btcutil.Amount(out.Value).ToBTC(),
+		Spendable:    true,
+	}
+	if btcAddr := addr.NewAddrFromPkScript(out.PkScript, netParams); btcAddr != nil {
+		u.Address = btcAddr.String()
+	}
+	return u
+}
+
+// The address of an output, for the psbt key origins
+func outputAddress(out *wire.TxOut) btcutil.Address {
+	if btcAddr := addr.NewAddrFromPkScript(out.PkScript, netParams); btcAddr != nil {
+		if decoded, err := btcutil.DecodeAddress(btcAddr.String(), netParams); err == nil {
+			return decoded
+		}
+	}
+	return nil
+}
+
+func bumpSummary(tx *wire.MsgTx, inputs *selectInputsResult, changeIndex int, changeUnknown bool, vsize int64, rate string) {
+	summary := &txSummary{tx: tx, changeIndex: changeIndex, changeUnknown: changeUnknown, vsize: vsize, rate: rate}
+	for _, input := range inputs.inputs {
+		amount, _ := btcutil.NewAmount(input.Amount)
+		summary.inputAmounts = append(summary.inputAmounts, amount)
+	}
+	summary.print(os.Stdout)
+}
+
+// Replaces the tx with the same one paying a higher fee out of its change
+func bumpRBF(stuck *stuckTx) (string, error) {
+	if !txbuild.SignalsRBF(stuck.tx) {
+		return "", fmt.Errorf("%s doesn't signal BIP125 replaceability, use --mode cpfp", stuck.txid)
+	}
+	// The replacement would evict them, dropping their payments
+	if stuck.descendants > 0 {
+		return "", fmt.Errorf("%s has %d unconfirmed descendants a replacement would evict, use --mode cpfp",
+			stuck.txid, stuck.descendants)
+	}
+	rate, source, err := chooseFeeRate()
+	if err != nil {
+		return "", err
+	}
+
+	tx := stuck.tx.Copy()
+	inputs := &selectInputsResult{}
+	for _, txIn := range tx.TxIn {
+		out, err := prevOut(txIn.PreviousOutPoint)
+		if err != nil {
+			return "", fmt.Errorf("input %s: %s", txIn.PreviousOutPoint, err)
+		}
+		inputs.inputs = append(inputs.inputs, unspentOf(txIn.PreviousOutPoint, out))
+		inputs.total += btcutil.Amount(out.Value)
+		txIn.SignatureScript = nil
+		txIn.Witness = nil
+	}
+	vsize := txbuild.EstimateVSize(tx, inputs.prevScripts())
+	// BIP125 counts the fees of every tx evicted, its descendants' too
+	fee := txbuild.ReplacementFee(stuck.descendantFees, vsize, rate)
+	change := tx.TxOut[stuck.changeIndex]
+	changeAddr := outputAddress(change)
+	changeIndex := stuck.changeIndex
+	newChange, err := txbuild.ReplacementChange(change, stuck.fee, fee)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s, use --mode cpfp", stuck.txid, err)
+	}
+	if newChange == 0 {
+		logger.Warn("the new fee leaves dust change, it goes to the fee")
+		tx.TxOut = append(tx.TxOut[:changeIndex], tx.TxOut[changeIndex+1:]...)
+		changeIndex = -1
+	} else {
+		change.Value = int64(newChange)
+	}
+	logger.Info("replacing", "txid", stuck.txid, "old_fee", stuck.fee.String(), "new_fee", fee.String())
+	bumpSummary(tx, inputs, changeIndex, false, vsize,
+		fmt.Sprintf("%s, %.2f sat/vB, replacing a %s fee", source, float64(rate), stuck.fee))
+	_, txid, err := signAndSend(tx, inputs, changeAddr, changeIndex)
+	return txid, err
+}
+
+// Spends the change of the tx in a child paying for both
+func bumpCPFP(stuck *stuckTx) (string, error) {
+	rate, source, err := chooseFeeRate()
+	if err != nil {
+		return "", err
+	}
+	hash := stuck.tx.TxHash()
+	op := wire.NewOutPoint(&hash, uint32(stuck.changeIndex))
+	parentChange := stuck.tx.TxOut[stuck.changeIndex]
+	inputs := &selectInputsResult{
+		total:  btcutil.Amount(parentChange.Value),
+		inputs: []btcjson.ListUnspentResult{unspentOf(*op, parentChange)},
+	}
+	changeAddr, err := changeAddress()
+	if err != nil {
+		return "", fmt.Errorf("could not get a change address: %s", err)
+	}
+	changeScript, err := changePkScript(changeAddr)
+	if err != nil {
+		return "", err
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	txIn := wire.NewTxIn(op, nil, nil)
+	if signalRBF {
+		txIn.Sequence = txbuild.RBFSequence
+	}
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(0, changeScript))
+	vsize := txbuild.EstimateVSize(tx, inputs.prevScripts())
+	fee := txbuild.CPFPFee(stuck.fee, stuck.vsize, vsize, rate)
+	if fee == 0 {
+		logger.Info("the tx already pays the fee rate, nothing to do", "txid", stuck.txid, "sat_per_vbyte", float64(rate))
+		return "", nil
+	}
+	value := inputs.total - fee
+	if txbuild.IsDust(value, changeScript) {
+		return "", fmt.Errorf("the change of %s (%s) can't pay a %s child fee", stuck.txid, inputs.total, fee)
+	}
+	tx.TxOut[0].Value = int64(value)
+	logger.Info("paying for the parent", "txid", stuck.txid, "parent_fee", stuck.fee.String(), "child_fee", fee.String())
+	bumpSummary(tx, inputs, 0, changeAddr == nil, vsize,
+		fmt.Sprintf("%s, %.2f sat/vB for parent and child", source, float64(rate)))
+	_, txid, err := signAndSend(tx, inputs, changeAddr, 0)
+	return txid, err
+}
+
+// Gets the unconfirmed tx mined sooner, by replacing it ("rbf") or spending
+// its change ("cpfp")
+func bump(txid, mode string) error {
+	stuck, err := getStuckTx(txid)
+	if err != nil {
+		return err
+	}
+	logger.Info("stuck tx", "txid", txid, "fee", stuck.fee.String(), "vsize", stuck.vsize,
+		"sat_per_vbyte", float64(stuck.fee)/float64(stuck.vsize))
+	var newTxid string
+	switch mode {
+	case "rbf":
+		newTxid, err = bumpRBF(stuck)
+	case "cpfp":
+		newTxid, err = bumpCPFP(stuck)
+	default:
+		return fmt.Errorf("unknown bump mode %q, use rbf or cpfp", mode)
+	}
+	if err == nil && newTxid != "" {
+		fmt.Printf("%s bumped by %s (%s)\n", txid, newTxid, mode)
+	}
+	return err
+}
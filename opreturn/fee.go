@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/libreoscar/btcwatch/rpcretry"
+	"github.com/libreoscar/btcwatch/txbuild"
+	"strconv"
+)
+
+// Set from --feerate and --conf-target
+var (
+	feeRateFlag float64
+	confTarget  = 6
+)
+
+type estimateSmartFeeResult struct {
+	FeeRate *float64 `json:"feerate"`
+	Errors  []string `json:"errors"`
+	Blocks  int      `json:"blocks"`
+}
+
+// Asks bitcoind for the rate getting a tx confirmed within target blocks
+func estimateSmartFee(target int) (txbuild.FeeRate, error) {
+	params := []json.RawMessage{json.RawMessage(strconv.Itoa(target))}
+	raw, err := rpcretry.Call(context.Background(), rpc, "estimatesmartfee", func() (json.RawMessage, error) {
+		return client.RawRequest("estimatesmartfee", params)
+	})
+	if err != nil {
+		return 0, err
+	}
+	var result estimateSmartFeeResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return 0, err
+	}
+	if result.FeeRate == nil {
+		return 0, fmt.Errorf("no fee estimate: %v", result.Errors)
+	}
+	return txbuild.FromBtcPerKvB(*result.FeeRate), nil
+}
+
+// Picks the fee rate from --feerate, else estimatesmartfee, else the
+// configured fallback, bounded by the configured floor and ceiling
+func chooseFeeRate() (rate txbuild.FeeRate, source string, err error) {
+	if feeRateFlag > 0 {
+		rate, source = txbuild.FeeRate(feeRateFlag), "--feerate"
+	} else if rate, err = estimateSmartFee(confTarget); err == nil {
+		source = fmt.Sprintf("estimatesmartfee %d blocks", confTarget)
+	} else if conf.FallbackFeeRate > 0 {
+		logger.Warn("fee estimation failed, using the fallback rate", "err", err)
+		rate, source, err = conf.FallbackFeeRate, "fallback", nil
+	} else {
+		return 0, "", fmt.Errorf("fee estimation failed (%s), use --feerate", err)
+	}
+	return rate.Clamp(conf.FeeRateFloor, conf.FeeRateCeiling), source, nil
+}
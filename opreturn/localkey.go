@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/codegangsta/cli"
+	"github.com/libreoscar/btcwatch/crypto"
+	"github.com/libreoscar/btcwatch/rpcretry"
+	"github.com/libreoscar/btcwatch/signer"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Set from --wif-file or --key-file: the key signing in-process instead of
+// the bitcoind wallet, and the address its coins and change sit on
+var (
+	localKey  *btcutil.WIF
+	localAddr btcutil.Address
+)
+
+// scantxoutset walks the whole UTXO set, give it more than a regular call
+const scanTimeout = 10 * time.Minute
+
+func readPassphrase(c *cli.Context) ([]byte, error) {
+	if path := c.GlobalString("passphrase-file"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		return []byte(strings.TrimRight(string(data), "\r\n")), err
+	}
+	if pass := os.Getenv("BTCWATCH_KEY_PASSPHRASE"); pass != "" {
+		return []byte(pass), nil
+	}
+	return nil, fmt.Errorf("set BTCWATCH_KEY_PASSPHRASE or --passphrase-file")
+}
+
+func loadLocalKey(c *cli.Context) error {
+	wifFile, keyFile := c.GlobalString("wif-file"), c.GlobalString("key-file")
+	if wifFile == "" && keyFile == "" {
+		return nil
+	}
+	if wifFile != "" && keyFile != "" {
+		return fmt.Errorf("--wif-file and --key-file can't be used together")
+	}
+	var err error
+	if wifFile != "" {
+		var data []byte
+		if data, err = ioutil.ReadFile(wifFile); err != nil {
+			return err
+		}
+		localKey, err = signer.ParseWIF(string(data))
+	} else {
+		var data, pass []byte
+		if data, err = ioutil.ReadFile(keyFile); err != nil {
+			return err
+		}
+		if pass, err = readPassphrase(c); err != nil {
+			return err
+		}
+		localKey, err = signer.DecryptKey(data, pass)
+	}
+	if err != nil {
+		return err
+	}
+	if !localKey.IsForNet(netParams) {
+		return fmt.Errorf("the key isn't for %s", netParams.Name)
+	}
+
+	hash := crypto.Rimp160AfterSha256(localKey.SerializePubKey())
+	switch c.GlobalString("key-type") {
+	case "p2wpkh":
+		if !localKey.CompressPubKey {
+			return fmt.Errorf("p2wpkh needs a compressed key, use --key-type p2pkh")
+		}
+		localAddr, err = btcutil.NewAddressWitnessPubKeyHash(hash[:], netParams)
+	case "p2pkh":
+		localAddr, err = btcutil.NewAddressPubKeyHash(hash[:], netParams)
+	default:
+		return fmt.Errorf("unknown --key-type %q, use p2wpkh or p2pkh", c.GlobalString("key-type"))
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("signing with a local key", "addr", localAddr.EncodeAddress())
+	return nil
+}
+
+type scanResult struct {
+	Height   int64 `json:"height"`
+	Unspents []struct {
+		TxID         string  `json:"txid"`
+		Vout         uint32  `json:"vout"`
+		ScriptPubKey string  `json:"scriptPubKey"`
+		Amount       float64 `json:"amount"`
+		Height       int64   `json:"height"`
+	} `json:"unspents"`
+}
+
+// Finds the coins of the local key in the node's UTXO set, no wallet needed,
+// plus the change of the txs sent meanwhile. The UTXO set only holds
+// confirmed outputs.
+func scanUnspent() ([]btcjson.ListUnspentResult, error) {
+	desc, _ := json.Marshal([]string{"addr(" + localAddr.EncodeAddress() + ")"})
+	scan := rpcretry.NewCaller(rpc.Policy)
+	if scan.Policy.Timeout.Duration < scanTimeout {
+		scan.Policy.Timeout.Duration = scanTimeout
+	}
+	raw, err := rpcretry.Call(context.Background(), scan, "scantxoutset", func() (json.RawMessage, error) {
+		return client.RawRequest("scantxoutset", []json.RawMessage{json.RawMessage(`"start"`), desc})
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result scanResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	// The UTXO set doesn't know what our unconfirmed txs spent and created
+	var unspents []btcjson.ListUnspentResult
+	for _, u := range result.Unspents {
+		if spentOutpoints[outpoint(u.TxID, u.Vout)] {
+			continue
+		}
+		unspents = append(unspents, btcjson.ListUnspentResult{
+			TxID:          u.TxID,
+			Vout:          u.Vout,
+			Address:       localAddr.EncodeAddress(),
+			ScriptPubKey:  u.ScriptPubKey,
+			Amount:        u.Amount,
+			Confirmations: result.Height - u.Height + 1,
+			Spendable:     true,
+		})
+	}
+	for _, change := range pendingChange {
+		if !spentOutpoints[outpoint(change.TxID, change.Vout)] {
+			unspents = append(unspents, change)
+		}
+	}
+	return unspents, nil
+}
+
+func listUnspent() ([]btcjson.ListUnspentResult, error) {
+	if localKey != nil {
+		return scanUnspent()
+	}
+	// Unconfirmed outputs too, --minconf filters them
+	return retry1("listunspent", client.ListUnspentMin, 0)
+}
+
+// Signs rawtx with the local key, or the bitcoind wallet without one
+func signTx(rawtx *wire.MsgTx, inputs *selectInputsResult) (*wire.MsgTx, error) {
+	if localKey == nil {
+		signed, err := signRawTransaction(rawtx)
+		if err != nil {
+			return nil, err
+		}
+		if !signed.complete {
+			return nil, fmt.Errorf("signature incomplete")
+		}
+		return signed.tx, nil
+	}
+	prevOuts := make([]*wire.TxOut, len(inputs.inputs))
+	for i, script := range inputs.prevScripts() {
+		amount, _ := btcutil.NewAmount(inputs.inputs[i].Amount)
+		prevOuts[i] = wire.NewTxOut(int64(amount), script)
+	}
+	signed := rawtx.Copy()
+	if err := signer.Sign(signed, prevOuts, localKey); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// Writes the WIF read from wifFile to keyFile, encrypted with the passphrase
+func encryptKeyFile(c *cli.Context, wifFile, keyFile string) error {
+	data, err := ioutil.ReadFile(wifFile)
+	if err != nil {
+		return err
+	}
+	wif, err := signer.ParseWIF(string(data))
+	if err != nil {
+		return err
+	}
+	pass, err := readPassphrase(c)
+	if err != nil {
+		return err
+	}
+	sealed, err := signer.EncryptKey(wif, pass)
+	if err != nil {
+		return err
+	}
+	// O_EXCL: never overwrite another key
+	f, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(sealed); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
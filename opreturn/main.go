@@ -1,283 +1,625 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/codegangsta/cli"
-	"github.com/libreoscar/btcrpcclient"
 	"github.com/davecgh/go-spew/spew"
-	"github.com/libreoscar/utils/log"
+	"github.com/libreoscar/btcwatch/braft"
+	"github.com/libreoscar/btcwatch/coinselect"
+	"github.com/libreoscar/btcwatch/logging"
+	"github.com/libreoscar/btcwatch/netparams"
+	"github.com/libreoscar/btcwatch/nulldata"
+	"github.com/libreoscar/btcwatch/rpcauth"
+	"github.com/libreoscar/btcwatch/rpcretry"
+	"github.com/libreoscar/btcwatch/txbuild"
 	"os"
-	"strconv"
+	"strings"
 )
 
 var _ = spew.Dump
 
 var (
-	FEE       = 0.0002
-	MAX_BYTES = 80
-	client    *btcrpcclient.Client
-	logger    = log.New(log.DEBUG)
+	client    *rpcclient.Client
+	logger    = logging.New(os.Stderr, logging.LevelInfo, false)
 	err       error
-	isTestnet = false
+	netParams = &chaincfg.MainNetParams
 	sendTx    = false
+	assumeYes = false
+	// Cleared by --no-rbf: txs signal BIP125 so bump can replace them
+	signalRBF = true
+	conf      *opReturnConf
+
+	// Set from --coin-selection and --minconf
+	coinSelection = "bnb"
+	minConf       = int64(1)
 )
 
-func posString(slice []string, element string) int {
-	for index, elem := range slice {
-		if elem == element {
-			return index
-		}
-	}
-	return -1
-}
+// What a change output costs: its own bytes now and the P2PKH input spending
+// it later. bnb looks for inputs wasting less than that instead.
+const changeCostVSize = 34 + 148
 
-func containsString(slice []string, element string) bool {
-	return !(posString(slice, element) == -1)
-}
+// How many unclear answers askForConfirmation takes before giving up
+const confirmAttempts = 3
 
-func askForConfirmation(msg string) bool {
-	fmt.Printf("%s Type yes or no:[Y/N]", msg)
+// Shared by every confirmation: a reader per question would drop what the
+// previous one buffered past its line
+var stdin = bufio.NewReader(os.Stdin)
 
-	var response string
-	_, err := fmt.Scanln(&response)
-	if err != nil {
-		logger.Crit(err.Error())
-	}
-	okayResponses := []string{"y", "Y", "yes", "Yes", "YES"}
-	nokayResponses := []string{"n", "N", "no", "No", "NO"}
-	if containsString(okayResponses, response) {
+// Asks msg on stdin, or answers yes with --yes. Anything but a yes, including
+// a closed stdin, is a no: scripts without --yes never broadcast by accident.
+func askForConfirmation(msg string) bool {
+	if assumeYes {
+		fmt.Printf("%s yes (--yes)\n", msg)
 		return true
-	} else if containsString(nokayResponses, response) {
-		return false
-	} else {
+	}
+	for i := 0; i < confirmAttempts; i++ {
+		fmt.Printf("%s Type yes or no:[Y/N]", msg)
+		line, err := stdin.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		if err != nil {
+			fmt.Println()
+			logger.Warn("no answer on stdin, use --yes to confirm non-interactively")
+			return false
+		}
 		fmt.Println("Please type yes or no and then press enter:")
-		return askForConfirmation(msg)
 	}
+	return false
 }
 
-func loadConf() *btcrpcclient.ConnConfig {
+type opReturnConf struct {
+	Host string
+	rpcauth.Conf
+	RPCRetry      rpcretry.Policy
+	Network       string
+	CustomNetwork *netparams.Custom
+
+	// sat/vB, a zero bound is ignored. FallbackFeeRate is used when
+	// estimatesmartfee has no answer, e.g. on regtest.
+	FeeRateFloor    txbuild.FeeRate
+	FeeRateCeiling  txbuild.FeeRate
+	FallbackFeeRate txbuild.FeeRate
+
+	// Where change goes, a fresh getrawchangeaddress one when empty
+	ChangeAddress string
+
+	// The node's -datacarriersize, bounding the OP_RETURN script
+	DataCarrierSize int
+}
+
+func loadConf() *opReturnConf {
 	file, err := os.Open("conf.json")
 	if err != nil {
 		logger.Crit("failed to open \"conf.json\"")
 		os.Exit(-1)
 	}
 	decoder := json.NewDecoder(file)
-	rpcConf := &btcrpcclient.ConnConfig{}
-	err = decoder.Decode(rpcConf)
+	conf := &opReturnConf{
+		RPCRetry:        rpcretry.DefaultPolicy(),
+		FeeRateFloor:    1,
+		FeeRateCeiling:  500,
+		DataCarrierSize: nulldata.DefaultDataCarrierSize,
+	}
+	err = decoder.Decode(conf)
 	if err != nil {
 		logger.Crit(fmt.Sprintf("decode error:%s", err.Error()))
 		os.Exit(-1)
 	}
-	rpcConf.HTTPPostMode = true
-	rpcConf.DisableTLS = true
-	return rpcConf
+	if err = conf.Validate(); err != nil {
+		logger.Crit(fmt.Sprintf("invalid conf.json:%s", err.Error()))
+		os.Exit(-1)
+	}
+	if err = conf.RPCRetry.Validate(); err != nil {
+		logger.Crit(fmt.Sprintf("invalid conf.json RPCRetry:%s", err.Error()))
+		os.Exit(-1)
+	}
+	return conf
+}
+
+func (c *opReturnConf) rpcConf() (*rpcclient.ConnConfig, error) {
+	user, pass, err := c.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	certs, err := c.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	return &rpcclient.ConnConfig{
+		Host:         c.Host,
+		User:         user,
+		Pass:         pass,
+		HTTPPostMode: true,
+		DisableTLS:   !c.TLS,
+		Certificates: certs,
+	}, nil
 }
 
 func messageToHex(msg wire.Message) (string, error) {
 	var buf bytes.Buffer
-	if err := msg.BtcEncode(&buf, 70002); err != nil {
-		return "", fmt.Errorf(fmt.Sprintf("Failed to encode msg of type %T", msg))
+	if err := msg.BtcEncode(&buf, 70002, wire.BaseEncoding); err != nil {
+		return "", fmt.Errorf("Failed to encode msg of type %T", msg)
 	}
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
-func toSatoshi(f float64) int64 {
-	return int64(f * 1e8)
-}
-
 type selectInputsResult struct {
-	total  float64
+	total  btcutil.Amount
 	inputs []btcjson.ListUnspentResult
 }
 
-func selectInputs(totalAmount float64) (*selectInputsResult, error) {
-	unspents, err := client.ListUnspent()
+func (r *selectInputsResult) prevScripts() [][]byte {
+	scripts := make([][]byte, len(r.inputs))
+	for i, input := range r.inputs {
+		scripts[i], _ = hex.DecodeString(input.ScriptPubKey)
+	}
+	return scripts
+}
+
+func selectInputs(strategy coinselect.Strategy, totalAmount btcutil.Amount) (*selectInputsResult, error) {
+	unspents, err := listUnspent()
 	if err != nil {
 		return nil, err
 	}
-	inputAmount := 0.0
-	var inputs []btcjson.ListUnspentResult
+	var utxos []coinselect.UTXO
+	byOutpoint := make(map[string]btcjson.ListUnspentResult)
 	for _, unspent := range unspents {
 		if !unspent.Spendable {
 			continue
 		}
-		inputs = append(inputs, unspent)
-		inputAmount += unspent.Amount
-		if inputAmount >= totalAmount {
-			break
+		// bitcoind prints 8 decimals, NewAmount rounds them back exactly
+		amount, err := btcutil.NewAmount(unspent.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("listunspent %s:%d: %s", unspent.TxID, unspent.Vout, err)
 		}
+		utxos = append(utxos, coinselect.UTXO{
+			TxID:          unspent.TxID,
+			Vout:          unspent.Vout,
+			Amount:        amount,
+			Confirmations: unspent.Confirmations,
+			Trusted:       sentTxids[unspent.TxID],
+		})
+		byOutpoint[outpoint(unspent.TxID, unspent.Vout)] = unspent
 	}
-	if inputAmount < totalAmount {
-		return nil, fmt.Errorf("not enough funds")
+	selected, err := strategy(utxos, totalAmount)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]btcjson.ListUnspentResult, len(selected))
+	for i, utxo := range selected {
+		inputs[i] = byOutpoint[outpoint(utxo.TxID, utxo.Vout)]
 	}
 	return &selectInputsResult{
-		total:  inputAmount,
+		total:  coinselect.Total(selected),
 		inputs: inputs,
 	}, nil
 }
 
-func createTx(inputs *selectInputsResult, addr btcutil.Address, amount float64, change float64, msg []byte) *wire.MsgTx {
-	tx := wire.NewMsgTx()
+// What payScript needs of validateaddress. rpcclient's result type has no
+// scriptPubKey, so the call is made raw.
+type validateAddressResult struct {
+	IsValid      bool   `json:"isvalid"`
+	ScriptPubKey string `json:"scriptPubKey"`
+}
+
+func validateAddress(addr btcutil.Address) (*validateAddressResult, error) {
+	param, _ := json.Marshal(addr.EncodeAddress())
+	raw, err := client.RawRequest("validateaddress", []json.RawMessage{param})
+	result := &validateAddressResult{}
+	if err != nil {
+		return result, err
+	}
+	return result, json.Unmarshal(raw, result)
+}
+
+// Returns the pk_script paying to addr, as the node sees it
+func payScript(addr btcutil.Address) ([]byte, error) {
+	result, err := retry1("validateaddress", validateAddress, addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not validate address: %s", err)
+	}
+	if !result.IsValid {
+		return nil, fmt.Errorf("invalid address %s", addr)
+	}
+	script, err := hex.DecodeString(result.ScriptPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scriptPubKey from validateaddress for %s", addr)
+	}
+	return script, nil
+}
+
+// Change goes to conf.json's ChangeAddress when set, else to a fresh wallet
+// address so no address is used twice. A local key has a single address.
+// Dry runs get nil instead of drawing a fresh address from the keypool.
+func changeAddress() (btcutil.Address, error) {
+	if conf.ChangeAddress != "" {
+		return btcutil.DecodeAddress(conf.ChangeAddress, netParams)
+	}
+	if localKey != nil {
+		return localAddr, nil
+	}
+	if !sendTx && psbtOut == "" {
+		return nil, nil
+	}
+	raw, err := retry0("getrawchangeaddress", func() (json.RawMessage, error) {
+		return client.RawRequest("getrawchangeaddress", nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	return btcutil.DecodeAddress(s, netParams)
+}
+
+// Sizes the change of dry runs, which have no change address: P2WPKH, the
+// wallet's default change type
+var dryRunChangeScript = append([]byte{txscript.OP_0, txscript.OP_DATA_20}, make([]byte, 20)...)
+
+func changePkScript(changeAddr btcutil.Address) ([]byte, error) {
+	if changeAddr == nil {
+		return dryRunChangeScript, nil
+	}
+	return payScript(changeAddr)
+}
+
+// One output of the tx: amount paid to addr
+type recipient struct {
+	addr   string
+	amount btcutil.Amount
+}
+
+// An output paying a recipient, its address resolved
+type payment struct {
+	script []byte
+	amount btcutil.Amount
+}
+
+// The outputs are the payments, the change if any, then the OP_RETURN.
+// Change below minChange or the dust threshold isn't worth an output, it's
+// left to the fee.
+func createTx(inputs *selectInputsResult, payments []payment, changeScript []byte, change, minChange btcutil.Amount, nullData []byte) (*wire.MsgTx, error) {
+	tx := wire.NewMsgTx(wire.TxVersion)
 	txIns := make([]*wire.TxIn, len(inputs.inputs))
 	for i, input := range inputs.inputs {
-		hash, err := wire.NewShaHashFromStr(input.TxID)
+		hash, err := chainhash.NewHashFromStr(input.TxID)
 		if err != nil {
-			logger.Crit("invalid txid")
-			os.Exit(0)
+			return nil, fmt.Errorf("invalid txid %q", input.TxID)
 		}
 		prevOut := wire.NewOutPoint(hash, input.Vout)
-		txIn := wire.NewTxIn(prevOut, nil)
+		txIn := wire.NewTxIn(prevOut, nil, nil)
+		if signalRBF {
+			txIn.Sequence = txbuild.RBFSequence
+		}
 		txIns[i] = txIn
 	}
 
-	txOuts := make([]*wire.TxOut, 3)
-
-	result, _ := client.ValidateAddress(addr)
-	if !result.IsValid {
-		logger.Crit("invalid address")
-		os.Exit(0)
-	}
-	addrPkScript := result.ScriptPubKey
-	addrPkScriptBin, _ := hex.DecodeString(addrPkScript)
-	txOut := wire.NewTxOut(toSatoshi(amount), addrPkScriptBin)
-	txOuts[0] = txOut
-
-	changePkScript := inputs.inputs[0].ScriptPubKey
-	changePKScriptBin, _ := hex.DecodeString(changePkScript)
-	txOut = wire.NewTxOut(toSatoshi(change), changePKScriptBin)
-	txOuts[1] = txOut
-
-	msgLen := len(msg)
-
-	var payload bytes.Buffer
-	payload.WriteByte(0x6a)
-	if msgLen <= 75 {
-		payload.WriteByte(byte(msgLen))
-	} else if msgLen <= 256 {
-		payload.WriteByte(0x4c)
-		payload.WriteByte(byte(msgLen))
+	var txOuts []*wire.TxOut
+	for _, p := range payments {
+		txOuts = append(txOuts, wire.NewTxOut(int64(p.amount), p.script))
+	}
+	if change < minChange || txbuild.IsDust(change, changeScript) {
+		logger.Debug("change not worth an output, left to the fee", "change", int64(change))
 	} else {
-		payload.WriteByte(0x4d)
-		payload.WriteByte(byte(msgLen % 256))
-		payload.WriteByte(byte(msgLen / 256))
+		txOuts = append(txOuts, wire.NewTxOut(int64(change), changeScript))
 	}
-	payload.Write(msg)
-	opReturnBin := payload.Bytes()
 
-	txOut = wire.NewTxOut(0, opReturnBin)
-	txOuts[2] = txOut
+	txOuts = append(txOuts, wire.NewTxOut(0, nullData))
 
 	tx.TxIn = txIns
 	tx.TxOut = txOuts
 
 	var buf bytes.Buffer
 	tx.Serialize(&buf)
-	logger.Info("Created Tx:")
-	logger.Info(spew.Sdump(hex.EncodeToString(buf.Bytes())))
+	logger.Debug("created tx", "inputs", len(tx.TxIn), "outputs", len(tx.TxOut), "hex", hex.EncodeToString(buf.Bytes()))
 
-	return tx
+	return tx, nil
 }
 
-func sendOpReturn(addr string, totalAmount float64, msg []byte) {
-	if len(msg) > MAX_BYTES {
-		logger.Crit("message oversize")
-		os.Exit(0)
+// Builds a tx paying the recipients with an OP_RETURN pushing each of
+// pushes, shows it and, with --real, signs and broadcasts it once confirmed.
+// Returns the txid, empty when the tx wasn't sent.
+func sendOpReturn(recipients []recipient, pushes [][]byte) (string, error) {
+	nullData, err := nulldata.Script(pushes...)
+	if err == nil {
+		err = nulldata.CheckPolicy(nullData, conf.DataCarrierSize)
 	}
-	btcAddr, err := btcutil.DecodeAddress(addr, &chaincfg.MainNetParams)
 	if err != nil {
-		logger.Crit("can't decode address")
-		os.Exit(0)
+		return "", fmt.Errorf("message oversize, at most %d bytes in a single push: %s",
+			nulldata.MaxSinglePush(conf.DataCarrierSize), err)
 	}
-	logger.Info("finding avaible inputs")
-	inputs, err := selectInputs(totalAmount + FEE)
+	payments := make([]payment, len(recipients))
+	var totalAmount btcutil.Amount
+	for i, r := range recipients {
+		btcAddr, err := btcutil.DecodeAddress(r.addr, netParams)
+		if err != nil {
+			return "", fmt.Errorf("can't decode address %q: %s", r.addr, err)
+		}
+		if payments[i].script, err = payScript(btcAddr); err != nil {
+			return "", err
+		}
+		payments[i].amount = r.amount
+		totalAmount += r.amount
+	}
+	rate, source, err := chooseFeeRate()
 	if err != nil {
-		logger.Crit(err.Error())
-		return
+		return "", err
+	}
+	logger.Info("fee rate", "sat_per_vbyte", float64(rate), "source", source)
+	// bnb accepts up to the cost of change as excess to avoid a change
+	// output; change below it costs more than it is worth whatever the
+	// strategy, so it is the one threshold of both
+	costOfChange := btcutil.Amount(rate.Fee(changeCostVSize))
+	strategy, err := coinselect.Lookup(coinSelection, costOfChange)
+	if err != nil {
+		return "", err
+	}
+	strategy = coinselect.MinConf(strategy, minConf)
+	changeAddr, err := changeAddress()
+	if err != nil {
+		return "", fmt.Errorf("could not get a change address: %s", err)
+	}
+	changeScript, err := changePkScript(changeAddr)
+	if err != nil {
+		return "", err
+	}
+	// bump finds the change by its address, a payment there would look
+	// like change
+	for _, p := range payments {
+		if bytes.Equal(p.script, changeScript) {
+			return "", fmt.Errorf("can't pay the change address %s, send to another address", changeAddr)
+		}
+	}
+
+	// The fee depends on the inputs, which depend on the fee: select again
+	// until the selected inputs pay for their own size
+	logger.Info("finding avaible inputs")
+	var inputs *selectInputsResult
+	var rawtx *wire.MsgTx
+	var fee btcutil.Amount
+	var vsize int64
+	for {
+		inputs, err = selectInputs(strategy, totalAmount+fee)
+		if err != nil {
+			return "", err
+		}
+		change := inputs.total - totalAmount - fee
+		rawtx, err = createTx(inputs, payments, changeScript, change, costOfChange, nullData)
+		if err != nil {
+			return "", err
+		}
+		vsize = txbuild.EstimateVSize(rawtx, inputs.prevScripts())
+		needed := btcutil.Amount(rate.Fee(vsize))
+		if needed <= fee {
+			break
+		}
+		fee = needed
+	}
+	changeIndex := -1
+	if len(rawtx.TxOut) == len(payments)+2 {
+		changeIndex = len(payments)
+	}
+	// Shows the fee actually paid, a bit higher than needed when small change
+	// was dropped
+	summary := &txSummary{
+		tx:            rawtx,
+		changeIndex:   changeIndex,
+		changeUnknown: changeAddr == nil,
+		vsize:         vsize,
+		rate:          fmt.Sprintf("%s, %.2f sat/vB", source, float64(rate)),
+	}
+	for _, input := range inputs.inputs {
+		amount, _ := btcutil.NewAmount(input.Amount)
+		summary.inputAmounts = append(summary.inputAmounts, amount)
 	}
-	change := inputs.total - totalAmount - FEE
-	rawtx := createTx(inputs, btcAddr, totalAmount, change, msg)
-
-	if sendTx {
-		signedTx, complete, err := client.SignRawTransaction(rawtx)
-		if err != nil || !complete {
-			logger.Crit(fmt.Sprintf("could not sign the tx: %s", err.Error()))
-			os.Exit(0)
-		} else {
-			var rawtx bytes.Buffer
-			signedTx.Serialize(&rawtx)
-			decodedTx, _ := client.DecodeRawTransaction(rawtx.Bytes())
-			logger.Info(spew.Sdump(decodedTx))
-
-			askForConfirmation("Are you going to send the tx? ")
-			txHash, err := client.SendRawTransaction(signedTx, false)
-			if err != nil {
-				logger.Crit("could not send the tx")
-				os.Exit(0)
-			} else {
-				logger.Info(fmt.Sprintf("tx sent: %s", txHash.String()))
-			}
+	summary.print(os.Stdout)
+
+	signedTx, txid, err := signAndSend(rawtx, inputs, changeAddr, changeIndex)
+	if err != nil || txid == "" {
+		return "", err
+	}
+	trackSent(txid, inputs, signedTx, changeIndex)
+	return txid, nil
+}
+
+// Exports rawtx with --psbt, else with --real signs it and broadcasts it once
+// confirmed. Returns the signed tx and its txid, empty when it wasn't sent.
+func signAndSend(rawtx *wire.MsgTx, inputs *selectInputsResult, changeAddr btcutil.Address, changeIndex int) (*wire.MsgTx, string, error) {
+	if psbtOut != "" {
+		packet, err := buildPsbt(rawtx, inputs, changeAddr, changeIndex)
+		if err == nil {
+			err = writePsbt(psbtOut, packet)
 		}
+		if err != nil {
+			return nil, "", fmt.Errorf("could not export the psbt: %s", err)
+		}
+		logger.Info("psbt exported, sign it and run finalize", "file", psbtOut)
+		return nil, "", nil
+	}
+	if !sendTx {
+		return nil, "", nil
 	}
+
+	signedTx, err := signTx(rawtx, inputs)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not sign the tx: %s", err)
+	}
+	var signed bytes.Buffer
+	signedTx.Serialize(&signed)
+	decodedTx, _ := retry1("decoderawtransaction", client.DecodeRawTransaction, signed.Bytes())
+	logger.Info("signed tx", "txid", signedTx.TxHash().String(), "bytes", signed.Len())
+	if logger.Enabled(logging.LevelDebug) {
+		logger.Debug("signed tx", "decoded", spew.Sdump(decodedTx))
+	}
+
+	if !askForConfirmation("Are you going to send the tx? ") {
+		logger.Info("tx not sent")
+		return nil, "", nil
+	}
+	txHash, err := sendRawTransaction(signedTx)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not send the tx: %s", err)
+	}
+	logger.Info("tx sent", "txid", txHash.String())
+	return signedTx, txHash.String(), nil
 }
 
-func buildBraftMsg(receiver string) (msg []byte) {
-	var buf bytes.Buffer
-	buf.Write([]byte("braft"))
-	buf.WriteByte(1)
-	receiverBin, err := hex.DecodeString(receiver)
+func buildBraftMsg(receiver string) ([]byte, error) {
+	receiverBin, err := braft.ParseReceiver(receiver)
 	if err != nil {
-		logger.Crit("could not decode braft address")
-		os.Exit(0)
+		return nil, err
 	}
-	buf.Write(receiverBin)
-	return buf.Bytes()
+	return braft.Encode(receiverBin)
 }
 
 func main() {
-	conf := loadConf()
-	client, err = btcrpcclient.New(conf, nil)
+	conf = loadConf()
+	rpcConf, err := conf.rpcConf()
+	if err != nil {
+		logger.Crit(err.Error())
+		return
+	}
+	client, err = rpcclient.New(rpcConf, nil)
 	if err != nil {
 		logger.Crit(err.Error())
 		return
 	}
 	defer client.Shutdown()
+	rpc.Policy = conf.RPCRetry
 
 	app := cli.NewApp()
 	app.Name = "Go OP_Return"
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "network",
+			Usage: "mainnet, testnet3, regtest, signet or custom (overrides conf.json)",
+		},
+		cli.BoolFlag{
+			Name:  "testnet",
+			Usage: "same as --network testnet3",
+		},
+		cli.StringFlag{
+			Name:  "log-level",
+			Value: "info",
+			Usage: "debug, info, warn, error or crit; debug dumps the txs",
+		},
+		cli.BoolFlag{
+			Name:  "log-json",
+			Usage: "log JSON records",
+		},
+		cli.Float64Flag{
+			Name:  "feerate",
+			Usage: "fee rate in sat/vB, instead of asking estimatesmartfee",
+		},
+		cli.IntFlag{
+			Name:  "conf-target",
+			Value: 6,
+			Usage: "confirmation target in blocks for estimatesmartfee",
+		},
+		cli.StringFlag{
+			Name:  "coin-selection",
+			Value: "bnb",
+			Usage: "bnb, largest-first, smallest-first or in-order",
+		},
+		cli.IntFlag{
+			Name:  "minconf",
+			Value: 1,
+			Usage: "only spend outputs with at least that many confirmations",
+		},
+		cli.StringFlag{
+			Name:  "psbt",
+			Usage: "write the unsigned tx as a base64 PSBT to this file (- for stdout) for an external signer",
+		},
+		cli.StringFlag{
+			Name:  "wif-file",
+			Usage: "sign with the WIF private key in this file instead of the bitcoind wallet",
+		},
+		cli.StringFlag{
+			Name:  "key-file",
+			Usage: "sign with the key of this encrypted key file (see encryptkey) instead of the bitcoind wallet",
+		},
+		cli.StringFlag{
+			Name:  "passphrase-file",
+			Usage: "file holding the key file passphrase, else read from BTCWATCH_KEY_PASSPHRASE",
+		},
+		cli.StringFlag{
+			Name:  "key-type",
+			Value: "p2wpkh",
+			Usage: "p2wpkh or p2pkh, the address of the local key holding the coins",
+		},
 		cli.BoolFlag{
-			Name: "testnet",
+			Name:  "no-rbf",
+			Usage: "don't signal BIP125 replaceability, bump can then only use cpfp",
 		},
 		cli.BoolFlag{
 			Name:  "real",
 			Usage: "send tx to btc network",
 		},
+		cli.BoolFlag{
+			Name:  "yes",
+			Usage: "don't ask before sending, for scripts",
+		},
 	}
 	app.Commands = []cli.Command{
 		{
 			Name:  "send",
 			Usage: "send op_return tx to address",
+			Flags: append(messageFlags, waitFlags...),
 			Action: func(c *cli.Context) {
-				if len(c.Args()) < 3 {
-					fmt.Println("send addr amount msg")
+				if len(c.Args()) < 2 {
+					fmt.Println("send addr amount msg\nsend [--hex data | --base64 data | --file path | --stdin] addr amount\n\namount is in BTC (0.001, 0.001btc) or satoshis (100000sat)")
 					return
 				}
 				addr := c.Args().First()
-				amount, err := strconv.ParseFloat(c.Args().Get(1), 64)
+				amount, err := txbuild.ParseAmount(c.Args().Get(1))
 				if err != nil {
-					logger.Crit("error parsing amount")
+					logger.Crit(err.Error())
 					return
 				}
-				msg := []byte(c.Args().Get(2))
-				logger.Info(fmt.Sprintf("crafting tx to %s with amount %v, msg \"%s\"", addr, amount, msg))
-				sendOpReturn(addr, amount, msg)
+				msg, err := readMessage(c)
+				if err != nil {
+					logger.Crit(err.Error())
+					os.Exit(1)
+				}
+				logger.Info("crafting tx", "addr", addr, "amount", amount.String(), "msg", hex.EncodeToString(msg), "text", printable(msg))
+				// The tx can't be in blocks mined before it was sent
+				var since int64
+				if c.Bool("wait") {
+					if since, err = getBlockCount(); err != nil {
+						logger.Crit(err.Error())
+						os.Exit(1)
+					}
+					since++
+				}
+				txid, err := sendOpReturn([]recipient{{addr, amount}}, [][]byte{msg})
+				if err != nil {
+					logger.Crit(err.Error())
+					os.Exit(1)
+				}
+				if c.Bool("wait") {
+					if txid == "" {
+						logger.Warn("tx not sent, nothing to wait for")
+						return
+					}
+					trackTx(c, txid, since)
+				}
 			},
 		},
 		{
@@ -285,34 +627,209 @@ func main() {
 			Usage: "send op_return tx to address",
 			Action: func(c *cli.Context) {
 				if len(c.Args()) < 3 {
-					fmt.Println("sendbraft addr amount braftAddr")
+					fmt.Println("sendbraft addr amount braftAddr\n\namount is in BTC (0.001, 0.001btc) or satoshis (100000sat)")
 					return
 				}
 				addr := c.Args().First()
-				amount, err := strconv.ParseFloat(c.Args().Get(1), 64)
+				amount, err := txbuild.ParseAmount(c.Args().Get(1))
 				if err != nil {
-					logger.Crit("error parsing amount")
+					logger.Crit(err.Error())
 					return
 				}
 				braftReceiver := c.Args().Get(2)
-				msg := buildBraftMsg(braftReceiver)
-				logger.Info(fmt.Sprintf("crafting tx to %s with amount %v, msg \"%s\"", addr, amount, hex.EncodeToString(msg)))
-				sendOpReturn(addr, amount, msg)
+				msg, err := buildBraftMsg(braftReceiver)
+				if err != nil {
+					logger.Crit("could not encode the braft message", "err", err)
+					os.Exit(1)
+				}
+				logger.Info("crafting tx", "addr", addr, "amount", amount.String(), "msg", hex.EncodeToString(msg))
+				if _, err := sendOpReturn([]recipient{{addr, amount}}, [][]byte{msg}); err != nil {
+					logger.Crit(err.Error())
+					os.Exit(1)
+				}
+			},
+		},
+		{
+			Name:  "sendbatch",
+			Usage: "send the op_return txs of a CSV (address,amount,message) or JSON file",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "mode",
+					Value: "chain",
+					Usage: "chain: a tx per row spending the previous change; multi: one tx paying every row, the messages as separate pushes",
+				},
+				cli.StringFlag{
+					Name:  "report",
+					Usage: "write the txid or error of every row to this JSON file",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 1 {
+					fmt.Println("sendbatch [--mode chain|multi] [--report file] batchFile")
+					return
+				}
+				exitBatch(sendBatch(c.Args().First(), c.String("mode"), c.String("report")))
+			},
+		},
+		{
+			Name:  "stamp",
+			Usage: "anchor the sha256 of files (their merkle root for several) in an op_return tx",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "proof",
+					Value: "stamp.json",
+					Usage: "where to write the proof checked by verify",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 1 {
+					fmt.Println("stamp [--proof stamp.json] file...")
+					return
+				}
+				if err := stampFiles(c.Args(), c.String("proof")); err != nil {
+					logger.Crit(err.Error())
+					os.Exit(1)
+				}
+			},
+		},
+		{
+			Name:  "verify",
+			Usage: "check files against a stamp proof and its tx",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "txid",
+					Usage: "the stamp tx, when the proof has none or another one",
+				},
+				cli.StringFlag{
+					Name:  "block",
+					Usage: "hash of the block holding the tx, needed without -txindex",
+				},
+				cli.BoolFlag{
+					Name:  "update",
+					Usage: "record the txid and block in the proof",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 1 {
+					fmt.Println("verify [--txid id] [--block hash] [--update] proof.json [file...]")
+					return
+				}
+				if err := verifyProof(c, c.Args().First(), c.Args().Tail()); err != nil {
+					logger.Crit("verification failed", "err", err)
+					os.Exit(1)
+				}
+			},
+		},
+		{
+			Name:  "bump",
+			Usage: "get a stuck tx mined sooner at --feerate or the estimated rate",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "mode",
+					Value: "rbf",
+					Usage: "rbf: replace the tx with one paying more out of its change; cpfp: spend its change in a child paying for both",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 1 {
+					fmt.Println("bump [--mode rbf|cpfp] txid")
+					return
+				}
+				if err := bump(c.Args().First(), c.String("mode")); err != nil {
+					logger.Crit(fmt.Sprintf("could not bump the tx: %s", err.Error()))
+					os.Exit(1)
+				}
+			},
+		},
+		{
+			Name:  "status",
+			Usage: "show whether a tx is in the mempool, confirmed or conflicted",
+			Flags: append([]cli.Flag{
+				cli.IntFlag{
+					Name:  "since",
+					Usage: "search the blocks from this height when the node can't find the tx (no wallet, no -txindex)",
+				},
+			}, waitFlags...),
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 1 {
+					fmt.Println("status [--wait] [--confirmations n] [--timeout d] [--since height] [--json] txid")
+					return
+				}
+				trackTx(c, c.Args().First(), int64(c.Int("since")))
+			},
+		},
+		{
+			Name:  "finalize",
+			Usage: "finalize a PSBT signed elsewhere, print the tx and send it with --real",
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 1 {
+					fmt.Println("finalize psbtFile (- for stdin)")
+					return
+				}
+				finalizePsbt(c.Args().First())
+			},
+		},
+		{
+			Name:  "encryptkey",
+			Usage: "encrypt the WIF of a file into a key file for --key-file",
+			Action: func(c *cli.Context) {
+				if len(c.Args()) < 2 {
+					fmt.Println("encryptkey wifFile keyFile")
+					return
+				}
+				if err := encryptKeyFile(c, c.Args().Get(0), c.Args().Get(1)); err != nil {
+					logger.Crit(fmt.Sprintf("could not encrypt the key: %s", err.Error()))
+					os.Exit(1)
+				}
+				logger.Info("key file written, the WIF file can be shredded", "file", c.Args().Get(1))
 			},
 		},
 	}
 	app.Before = func(c *cli.Context) error {
-		if c.GlobalBool("testnet") {
-			isTestnet = true
+		level, err := logging.ParseLevel(c.GlobalString("log-level"))
+		if err != nil {
+			return err
+		}
+		logger = logging.New(os.Stderr, level, c.GlobalBool("log-json"))
+		network := conf.Network
+		if c.GlobalString("network") != "" {
+			network = c.GlobalString("network")
+		} else if c.GlobalBool("testnet") {
+			network = "testnet3"
 		}
-		if isTestnet {
-			logger.Info("using testnet")
-		} else {
-			logger.Info("using mainchain")
+		netParams, err = netparams.Lookup(network, conf.CustomNetwork)
+		if err != nil {
+			return err
 		}
+		logger.Info("network selected", "network", netParams.Name)
+		feeRateFlag = c.GlobalFloat64("feerate")
+		confTarget = c.GlobalInt("conf-target")
+		if feeRateFlag < 0 || confTarget < 1 {
+			return fmt.Errorf("--feerate can't be negative and --conf-target must be at least 1")
+		}
+		coinSelection = c.GlobalString("coin-selection")
+		if _, err := coinselect.Lookup(coinSelection, 0); err != nil {
+			return err
+		}
+		minConf = int64(c.GlobalInt("minconf"))
+		if minConf < 0 {
+			return fmt.Errorf("--minconf can't be negative")
+		}
+		psbtOut = c.GlobalString("psbt")
+		assumeYes = c.GlobalBool("yes")
+		signalRBF = !c.GlobalBool("no-rbf")
 		if c.GlobalBool("real") {
 			sendTx = true
 		}
+		if sendTx && psbtOut != "" {
+			return fmt.Errorf("--psbt exports the tx for another signer, it can't be used with --real")
+		}
+		if err := loadLocalKey(c); err != nil {
+			return err
+		}
+		if localKey != nil && psbtOut != "" {
+			return fmt.Errorf("--psbt is for external signers, it can't be used with a local key")
+		}
 		if sendTx {
 			logger.Info("tx will be sent to bitcoind")
 		}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/libreoscar/btcwatch/nulldata"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+var messageFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "hex",
+		Usage: "the message, hex encoded",
+	},
+	cli.StringFlag{
+		Name:  "base64",
+		Usage: "the message, base64 encoded",
+	},
+	cli.StringFlag{
+		Name:  "file",
+		Usage: "read the raw message from this file",
+	},
+	cli.BoolFlag{
+		Name:  "stdin",
+		Usage: "read the raw message from stdin",
+	},
+}
+
+// Returns the message of send: the third argument, or one of --hex,
+// --base64, --file and --stdin, checked against the OP_RETURN size limit
+func readMessage(c *cli.Context) ([]byte, error) {
+	var sources []string
+	if len(c.Args()) > 2 {
+		sources = append(sources, "argument")
+	}
+	for _, name := range []string{"hex", "base64", "file"} {
+		if c.String(name) != "" {
+			sources = append(sources, "--"+name)
+		}
+	}
+	if c.Bool("stdin") {
+		sources = append(sources, "--stdin")
+	}
+	if len(sources) != 1 {
+		return nil, fmt.Errorf("give the message exactly once, got %d sources %v", len(sources), sources)
+	}
+	if sources[0] == "--stdin" && sendTx && !assumeYes {
+		// The confirmation would read the end of the message
+		return nil, fmt.Errorf("--stdin takes stdin from the confirmation, add --yes")
+	}
+
+	var msg []byte
+	var err error
+	switch sources[0] {
+	case "argument":
+		msg = []byte(c.Args().Get(2))
+	case "--hex":
+		msg, err = hex.DecodeString(strings.TrimSpace(c.String("hex")))
+	case "--base64":
+		msg, err = base64.StdEncoding.DecodeString(strings.TrimSpace(c.String("base64")))
+	case "--file":
+		msg, err = ioutil.ReadFile(c.String("file"))
+	case "--stdin":
+		// One byte more than allowed is enough to reject it
+		msg, err = ioutil.ReadAll(io.LimitReader(stdin, nulldata.MaxPushSize+1))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad message (%s): %s", sources[0], err)
+	}
+	if max := nulldata.MaxSinglePush(conf.DataCarrierSize); len(msg) > max {
+		return nil, fmt.Errorf("message is %d bytes, at most %d fit in an OP_RETURN (DataCarrierSize %d)",
+			len(msg), max, conf.DataCarrierSize)
+	}
+	return msg, nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/libreoscar/btcwatch/psbt"
+	"github.com/libreoscar/btcwatch/txbuild"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Set from --psbt: where to write the unsigned tx instead of signing it
+var psbtOut string
+
+// Wallet metadata of an address, what signers need to recognize their keys
+type addressInfo struct {
+	PubKey              string `json:"pubkey"`
+	HDKeyPath           string `json:"hdkeypath"`
+	HDMasterFingerprint string `json:"hdmasterfingerprint"`
+	IsMine              bool   `json:"ismine"`
+	IsChange            bool   `json:"ischange"`
+	// The redeem script of a P2SH address, also the scriptPubKey of the
+	// embedded address
+	Hex      string `json:"hex"`
+	Embedded *struct {
+		ScriptPubKey string `json:"scriptPubKey"`
+	} `json:"embedded"`
+}
+
+func getAddressInfo(addr string) (*addressInfo, error) {
+	param, _ := json.Marshal(addr)
+	raw, err := retry0("getaddressinfo", func() (json.RawMessage, error) {
+		return client.RawRequest("getaddressinfo", []json.RawMessage{param})
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := &addressInfo{}
+	return info, json.Unmarshal(raw, info)
+}
+
+// Returns the wallet tx spent by an input, signers check the amount with it
+func getWalletTx(txid string) (*wire.MsgTx, error) {
+	param, _ := json.Marshal(txid)
+	raw, err := retry0("gettransaction", func() (json.RawMessage, error) {
+		return client.RawRequest("gettransaction", []json.RawMessage{param})
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Hex string `json:"hex"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	txBytes, err := hex.DecodeString(result.Hex)
+	if err != nil {
+		return nil, err
+	}
+	tx := &wire.MsgTx{}
+	return tx, tx.Deserialize(bytes.NewReader(txBytes))
+}
+
+// Parses "m/84'/1'/0'/0/3", h also marks hardened indexes
+func parseKeyPath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("invalid key path %q", path)
+	}
+	var indexes []uint32
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key path %q", path)
+		}
+		if hardened {
+			index += 0x80000000
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// The BIP32 origin of addr's key when the wallet knows it, nil otherwise:
+// legacy wallets and imported keys have none
+func derivation(addr string) []psbt.Bip32Derivation {
+	info, err := getAddressInfo(addr)
+	if err != nil {
+		logger.Warn("getaddressinfo failed, no key origin in the psbt", "addr", addr, "err", err)
+		return nil
+	}
+	return keyOrigin(addr, info)
+}
+
+func keyOrigin(addr string, info *addressInfo) []psbt.Bip32Derivation {
+	pubKey, err1 := hex.DecodeString(info.PubKey)
+	fingerprint, err2 := hex.DecodeString(info.HDMasterFingerprint)
+	path, err3 := parseKeyPath(info.HDKeyPath)
+	if err1 != nil || err2 != nil || err3 != nil || len(pubKey) == 0 || len(fingerprint) != 4 {
+		logger.Debug("no key origin for address", "addr", addr)
+		return nil
+	}
+	return []psbt.Bip32Derivation{{
+		PubKey:      pubKey,
+		Fingerprint: binary.LittleEndian.Uint32(fingerprint),
+		Path:        path,
+	}}
+}
+
+func redeemScript(info *addressInfo) []byte {
+	script := info.Hex
+	if script == "" && info.Embedded != nil {
+		script = info.Embedded.ScriptPubKey
+	}
+	b, _ := hex.DecodeString(script)
+	return b
+}
+
+func buildPsbt(tx *wire.MsgTx, inputs *selectInputsResult, changeAddr btcutil.Address, changeIndex int) (*psbt.Packet, error) {
+	packet, err := psbt.New(tx)
+	if err != nil {
+		return nil, err
+	}
+	prevScripts := inputs.prevScripts()
+	for i, input := range inputs.inputs {
+		in := &packet.Inputs[i]
+		if in.NonWitnessUtxo, err = getWalletTx(input.TxID); err != nil {
+			return nil, fmt.Errorf("input %s:%d: %s", input.TxID, input.Vout, err)
+		}
+		if _, witness := txbuild.InputSigWeight(prevScripts[i]); witness {
+			amount, _ := btcutil.NewAmount(input.Amount)
+			in.WitnessUtxo = wire.NewTxOut(int64(amount), prevScripts[i])
+		}
+		info, err := getAddressInfo(input.Address)
+		if err != nil && txscript.IsPayToScriptHash(prevScripts[i]) {
+			return nil, fmt.Errorf("input %s:%d: no redeem script: %s", input.TxID, input.Vout, err)
+		} else if err != nil {
+			logger.Warn("getaddressinfo failed, no key origin in the psbt", "addr", input.Address, "err", err)
+			continue
+		}
+		in.Bip32Derivation = keyOrigin(input.Address, info)
+		// Signers and finalize need the redeem script of P2SH-P2WPKH
+		if txscript.IsPayToScriptHash(prevScripts[i]) {
+			if err := packet.SetRedeemScript(i, redeemScript(info)); err != nil {
+				return nil, fmt.Errorf("input %s:%d: %s", input.TxID, input.Vout, err)
+			}
+		}
+	}
+	// Lets hardware wallets show the change as theirs
+	if changeIndex >= 0 {
+		packet.Outputs[changeIndex].Bip32Derivation = derivation(changeAddr.EncodeAddress())
+	}
+	return packet, nil
+}
+
+// Writes the psbt in base64 to path, - is stdout
+func writePsbt(path string, packet *psbt.Packet) error {
+	b64, err := packet.B64Encode()
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		fmt.Println(b64)
+		return nil
+	}
+	return ioutil.WriteFile(path, []byte(b64+"\n"), 0600)
+}
+
+// Finalizes a psbt signed elsewhere and broadcasts it with --real
+func finalizePsbt(path string) {
+	var data []byte
+	var err error
+	if path == "-" && sendTx && !assumeYes {
+		// The confirmation would find stdin at its end
+		logger.Crit("finalize - takes stdin from the confirmation, add --yes")
+		os.Exit(1)
+	}
+	if path == "-" {
+		data, err = ioutil.ReadAll(stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		logger.Crit(fmt.Sprintf("could not read the psbt: %s", err.Error()))
+		os.Exit(1)
+	}
+	packet, err := psbt.Decode(data)
+	if err != nil {
+		logger.Crit(err.Error())
+		os.Exit(1)
+	}
+	if err := packet.Finalize(); err != nil {
+		logger.Crit(fmt.Sprintf("could not finalize the psbt: %s", err.Error()))
+		os.Exit(1)
+	}
+	signedTx, err := packet.Extract()
+	if err != nil {
+		logger.Crit(err.Error())
+		os.Exit(1)
+	}
+	summary := &txSummary{tx: signedTx, changeIndex: -1}
+	for i, in := range packet.Inputs {
+		index := signedTx.TxIn[i].PreviousOutPoint.Index
+		if in.WitnessUtxo != nil {
+			summary.inputAmounts = append(summary.inputAmounts, btcutil.Amount(in.WitnessUtxo.Value))
+		} else if in.NonWitnessUtxo != nil && int(index) < len(in.NonWitnessUtxo.TxOut) {
+			summary.inputAmounts = append(summary.inputAmounts, btcutil.Amount(in.NonWitnessUtxo.TxOut[index].Value))
+		} else {
+			// The fee can't be shown
+			summary.inputAmounts = nil
+			break
+		}
+	}
+	summary.print(os.Stdout)
+
+	var buf bytes.Buffer
+	signedTx.Serialize(&buf)
+	fmt.Println(hex.EncodeToString(buf.Bytes()))
+	logger.Info("finalized tx", "txid", signedTx.TxHash().String(), "bytes", buf.Len())
+
+	if sendTx {
+		if !askForConfirmation("Are you going to send the tx? ") {
+			logger.Info("tx not sent")
+			return
+		}
+		txHash, err := sendRawTransaction(signedTx)
+		if err != nil {
+			logger.Crit(fmt.Sprintf("could not send the tx: %s", err.Error()))
+			os.Exit(1)
+		}
+		logger.Info("tx sent", "txid", txHash.String())
+	}
+}
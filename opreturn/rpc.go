@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/libreoscar/btcwatch/rpcretry"
+	"strings"
+)
+
+// Every bitcoind call of the tool goes through rpc, see conf.json's RPCRetry
+var rpc = rpcretry.NewCaller(rpcretry.DefaultPolicy())
+
+// Runs an RPC call without arguments under the retry policy
+func retry0[T any](method string, fn func() (T, error)) (T, error) {
+	return rpcretry.Call(context.Background(), rpc, method, fn)
+}
+
+// Runs an RPC call with one argument under the retry policy
+func retry1[A, T any](method string, fn func(A) (T, error), arg A) (T, error) {
+	return rpcretry.Call(context.Background(), rpc, method, func() (T, error) {
+		return fn(arg)
+	})
+}
+
+type signResult struct {
+	tx       *wire.MsgTx
+	complete bool
+}
+
+// Signs tx with the bitcoind wallet. signrawtransaction is gone since 0.18,
+// signrawtransactionwithwallet replaces it.
+func signRawTransaction(tx *wire.MsgTx) (*signResult, error) {
+	return rpcretry.Call(context.Background(), rpc, "signrawtransactionwithwallet", func() (*signResult, error) {
+		signed, complete, err := client.SignRawTransactionWithWallet(tx)
+		if err != nil {
+			return nil, err
+		}
+		return &signResult{signed, complete}, nil
+	})
+}
+
+// Broadcasts tx. A retry after a timeout can find the tx already accepted
+// by the attempt that timed out: that is a success, not a failure.
+func sendRawTransaction(tx *wire.MsgTx) (*chainhash.Hash, error) {
+	return rpcretry.Call(context.Background(), rpc, "sendrawtransaction", func() (*chainhash.Hash, error) {
+		hash, err := client.SendRawTransaction(tx, false)
+		if err != nil && alreadyBroadcast(err) {
+			txHash := tx.TxHash()
+			logger.Info("tx already known to bitcoind", "txid", txHash.String(), "err", err)
+			return &txHash, nil
+		}
+		return hash, err
+	})
+}
+
+// bitcoind's answers to a tx it already has in its mempool or chain
+func alreadyBroadcast(err error) bool {
+	var rpcErr *btcjson.RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == btcjson.ErrRPCTxAlreadyInChain {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "txn-already-in-mempool") || strings.Contains(msg, "txn-already-known") ||
+		strings.Contains(msg, "already in block chain")
+}
+
+// What the tool needs of getrawtransaction's verbose result
+type rawTxResult struct {
+	Hex           string `json:"hex"`
+	BlockHash     string `json:"blockhash"`
+	Confirmations int64  `json:"confirmations"`
+}
+
+func (r *rawTxResult) tx() (*wire.MsgTx, error) {
+	txBytes, err := hex.DecodeString(r.Hex)
+	if err != nil {
+		return nil, err
+	}
+	tx := &wire.MsgTx{}
+	return tx, tx.Deserialize(bytes.NewReader(txBytes))
+}
+
+// Fetches txid from the mempool, or from blockHash when known so no
+// -txindex is needed for confirmed txs
+func getRawTransaction(txid, blockHash string) (*rawTxResult, error) {
+	params := []interface{}{txid, true}
+	if blockHash != "" {
+		params = append(params, blockHash)
+	}
+	var rawParams []json.RawMessage
+	for _, p := range params {
+		raw, _ := json.Marshal(p)
+		rawParams = append(rawParams, raw)
+	}
+	raw, err := retry0("getrawtransaction", func() (json.RawMessage, error) {
+		return client.RawRequest("getrawtransaction", rawParams)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &rawTxResult{}
+	return result, json.Unmarshal(raw, result)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/codegangsta/cli"
+	"github.com/libreoscar/btcwatch/nulldata"
+	"github.com/libreoscar/btcwatch/stamp"
+)
+
+// Hashes the files, sends their root and writes the proof. The proof has no
+// txid unless the tx is broadcast: with --psbt pass it to verify with --txid.
+func stampFiles(names []string, proofPath string) error {
+	proof, err := stamp.NewProof(names)
+	if err != nil {
+		return err
+	}
+	proof.Network = netParams.Name
+	root, _ := proof.RootHash()
+	logger.Info("stamping", "files", len(names), "root", proof.Root)
+	if proof.Txid, err = sendOpReturn(nil, [][]byte{stamp.Payload(root)}); err != nil {
+		return err
+	}
+	if proof.Txid == "" {
+		logger.Warn("tx not sent, the proof has no txid")
+	}
+	if err := proof.Write(proofPath); err != nil {
+		return fmt.Errorf("could not write the proof: %s", err)
+	}
+	logger.Info("proof written", "file", proofPath, "txid", proof.Txid)
+	return nil
+}
+
+func getBlockHeight(blockHash string) (int64, error) {
+	param, _ := json.Marshal(blockHash)
+	raw, err := retry0("getblockheader", func() (json.RawMessage, error) {
+		return client.RawRequest("getblockheader", []json.RawMessage{param})
+	})
+	if err != nil {
+		return 0, err
+	}
+	var header struct {
+		Height        int64 `json:"height"`
+		Confirmations int64 `json:"confirmations"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return 0, err
+	}
+	if header.Confirmations < 0 {
+		return 0, fmt.Errorf("block %s isn't in the main chain", blockHash)
+	}
+	return header.Height, nil
+}
+
+// Whether an OP_RETURN of tx carries a stamp of root
+func anchors(tx *wire.MsgTx, root stamp.Hash) bool {
+	for _, out := range tx.TxOut {
+		pushes, err := nulldata.Parse(out.PkScript)
+		if err != nil {
+			continue
+		}
+		for _, push := range pushes {
+			if got, err := stamp.ParsePayload(push); err == nil && got == root {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks the files against the proof, then the proof's root against its tx.
+// Without files every file of the proof is hashed again from its name.
+func verifyProof(c *cli.Context, proofPath string, names []string) error {
+	proof, err := stamp.ReadProof(proofPath)
+	if err != nil {
+		return err
+	}
+	if proof.Network != "" && proof.Network != netParams.Name {
+		return fmt.Errorf("the proof is for %s, not %s", proof.Network, netParams.Name)
+	}
+	root, err := proof.RootHash()
+	if err != nil {
+		return err
+	}
+
+	var entries []*stamp.FileProof
+	if len(names) == 0 {
+		for i := range proof.Files {
+			names = append(names, proof.Files[i].Name)
+		}
+	}
+	for _, name := range names {
+		h, err := stamp.HashFile(name)
+		if err != nil {
+			return err
+		}
+		entry := proof.Find(h)
+		if entry == nil {
+			return fmt.Errorf("%s (sha256 %s) isn't in the proof", name, h)
+		}
+		if err := proof.Check(entry); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	txid := proof.Txid
+	if c.String("txid") != "" {
+		txid = c.String("txid")
+	}
+	if txid == "" {
+		return fmt.Errorf("the proof has no txid, give it with --txid")
+	}
+	blockHash := proof.BlockHash
+	if c.String("block") != "" {
+		blockHash = c.String("block")
+	}
+	result, err := getRawTransaction(txid, blockHash)
+	if err != nil {
+		if blockHash == "" {
+			return fmt.Errorf("could not get tx %s, give its block with --block or enable -txindex: %s", txid, err)
+		}
+		return fmt.Errorf("tx %s not found in block %s: %s", txid, blockHash, err)
+	}
+	tx, err := result.tx()
+	if err != nil {
+		return err
+	}
+	if !anchors(tx, root) {
+		return fmt.Errorf("tx %s doesn't carry the root %s", txid, proof.Root)
+	}
+	if result.BlockHash == "" {
+		fmt.Printf("%d file(s) match root %s of tx %s, not confirmed yet\n", len(entries), proof.Root, txid)
+		return nil
+	}
+	height, err := getBlockHeight(result.BlockHash)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s  %s\n", entry.SHA256, entry.Name)
+	}
+	fmt.Printf("%d file(s) anchored by tx %s in block %d (%s), %d confirmations\n",
+		len(entries), txid, height, result.BlockHash, result.Confirmations)
+
+	if c.Bool("update") && (proof.BlockHash != result.BlockHash || proof.Txid != txid) {
+		proof.Txid, proof.BlockHash, proof.BlockHeight = txid, result.BlockHash, height
+		if err := proof.Write(proofPath); err != nil {
+			return err
+		}
+		logger.Info("proof updated", "file", proofPath)
+	}
+	return nil
+}
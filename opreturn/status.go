@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/codegangsta/cli"
+	"os"
+	"time"
+)
+
+// States of a tracked tx
+const (
+	stateMempool    = "mempool"
+	stateConfirmed  = "confirmed"
+	stateConflicted = "conflicted" // an input was spent by another tx
+	stateDropped    = "dropped"    // out of the mempool, inputs unspent
+	stateUnknown    = "unknown"
+)
+
+var waitFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "wait",
+		Usage: "poll until the tx has --confirmations, fail on conflicts and after --timeout",
+	},
+	cli.IntFlag{
+		Name:  "confirmations",
+		Value: 1,
+		Usage: "confirmations --wait waits for",
+	},
+	cli.DurationFlag{
+		Name:  "timeout",
+		Value: 2 * time.Hour,
+		Usage: "how long --wait waits",
+	},
+	cli.DurationFlag{
+		Name:  "interval",
+		Value: 30 * time.Second,
+		Usage: "how often --wait polls the node",
+	},
+	cli.BoolFlag{
+		Name:  "json",
+		Usage: "print the status as JSON, a line per change",
+	},
+}
+
+type txStatus struct {
+	Txid          string
+	State         string
+	Confirmations int64
+	BlockHash     string `json:",omitempty"`
+	BlockHeight   int64  `json:",omitempty"`
+	// Index of the tx in its block, the coinbase being 0
+	Position  int      `json:",omitempty"`
+	Conflicts []string `json:",omitempty"`
+}
+
+// Follows a tx across polls: once seen, its inputs tell a conflict from a
+// tx confirmed in a block the node can't look up without -txindex
+type txTracker struct {
+	txid string
+	tx   *wire.MsgTx
+	// Blocks from this height are searched when the tx isn't found, 0 never
+	since int64
+}
+
+// What status needs of gettransaction
+type walletTx struct {
+	Hex             string   `json:"hex"`
+	Confirmations   int64    `json:"confirmations"`
+	BlockHash       string   `json:"blockhash"`
+	BlockIndex      int      `json:"blockindex"`
+	WalletConflicts []string `json:"walletconflicts"`
+	// Set on a tx replaced through BIP125
+	ReplacedBy string `json:"replaced_by_txid"`
+}
+
+func getWalletTxInfo(txid string) (*walletTx, error) {
+	param, _ := json.Marshal(txid)
+	raw, err := retry0("gettransaction", func() (json.RawMessage, error) {
+		return client.RawRequest("gettransaction", []json.RawMessage{param})
+	})
+	if err != nil {
+		return nil, err
+	}
+	tx := &walletTx{}
+	return tx, json.Unmarshal(raw, tx)
+}
+
+// What status needs of getblock
+type blockTxs struct {
+	Height        int64    `json:"height"`
+	Confirmations int64    `json:"confirmations"`
+	Tx            []string `json:"tx"`
+}
+
+func getBlockTxs(blockHash string) (*blockTxs, error) {
+	param, _ := json.Marshal(blockHash)
+	raw, err := retry0("getblock", func() (json.RawMessage, error) {
+		return client.RawRequest("getblock", []json.RawMessage{param, json.RawMessage("1")})
+	})
+	if err != nil {
+		return nil, err
+	}
+	block := &blockTxs{}
+	return block, json.Unmarshal(raw, block)
+}
+
+func getBlockCount() (int64, error) {
+	raw, err := retry0("getblockcount", func() (json.RawMessage, error) {
+		return client.RawRequest("getblockcount", nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	return count, json.Unmarshal(raw, &count)
+}
+
+func getBlockHashAt(height int64) (string, error) {
+	raw, err := retry0("getblockhash", func() (json.RawMessage, error) {
+		return client.RawRequest("getblockhash", []json.RawMessage{json.RawMessage(fmt.Sprint(height))})
+	})
+	if err != nil {
+		return "", err
+	}
+	var hash string
+	return hash, json.Unmarshal(raw, &hash)
+}
+
+// Fills the block fields of s from the block holding the tx
+func (s *txStatus) setBlock(blockHash string) error {
+	block, err := getBlockTxs(blockHash)
+	if err != nil {
+		return err
+	}
+	if block.Confirmations < 0 {
+		// Reorged out, the tx is back in the mempool or conflicted
+		return fmt.Errorf("block %s isn't in the main chain", blockHash)
+	}
+	s.State = stateConfirmed
+	s.BlockHash, s.BlockHeight, s.Confirmations = blockHash, block.Height, block.Confirmations
+	for i, txid := range block.Tx {
+		if txid == s.Txid {
+			s.Position = i
+		}
+	}
+	return nil
+}
+
+// Looks for the tx in the blocks mined since t.since
+func (t *txTracker) scanBlocks(s *txStatus) (bool, error) {
+	if t.since <= 0 {
+		return false, nil
+	}
+	tip, err := getBlockCount()
+	if err != nil {
+		return false, err
+	}
+	for height := t.since; height <= tip; height++ {
+		hash, err := getBlockHashAt(height)
+		if err != nil {
+			return false, err
+		}
+		block, err := getBlockTxs(hash)
+		if err != nil {
+			return false, err
+		}
+		for _, txid := range block.Tx {
+			if txid == t.txid {
+				return true, s.setBlock(hash)
+			}
+		}
+	}
+	return false, nil
+}
+
+// Whether every input of the tx is still unspent, mempool included
+func inputsUnspent(tx *wire.MsgTx) (bool, error) {
+	for _, txIn := range tx.TxIn {
+		op := txIn.PreviousOutPoint
+		params := []json.RawMessage{json.RawMessage(`"` + op.Hash.String() + `"`),
+			json.RawMessage(fmt.Sprint(op.Index)), json.RawMessage("true")}
+		raw, err := retry0("gettxout", func() (json.RawMessage, error) {
+			return client.RawRequest("gettxout", params)
+		})
+		if err != nil {
+			return false, err
+		}
+		if string(raw) == "null" || len(raw) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Asks the wallet first, it knows conflicts and confirmed txs without
+// -txindex, then the mempool and -txindex, then the blocks since t.since.
+// A tx found nowhere with an input spent is conflicted, unless asking again
+// finds it mined meanwhile; without the wallet and --since that can't be
+// told and is an error.
+func (t *txTracker) check() (*txStatus, error) {
+	s := &txStatus{Txid: t.txid, State: stateUnknown}
+	// The wallet follows the chain: a tx it has unconfirmed isn't in a block
+	var unconfirmed *walletTx
+	if localKey == nil {
+		if wtx, err := getWalletTxInfo(t.txid); err == nil {
+			if t.tx == nil {
+				t.tx, _ = (&rawTxResult{Hex: wtx.Hex}).tx()
+			}
+			switch {
+			case wtx.Confirmations > 0:
+				return s, s.setBlock(wtx.BlockHash)
+			case wtx.Confirmations < 0:
+				s.State, s.Conflicts = stateConflicted, wtx.WalletConflicts
+				return s, nil
+			}
+			// Unconfirmed: in the mempool, dropped or conflicted, see below
+			unconfirmed = wtx
+		}
+	}
+
+	if result, err := getRawTransaction(t.txid, ""); err == nil {
+		if t.tx == nil {
+			t.tx, _ = result.tx()
+		}
+		if result.BlockHash != "" {
+			return s, s.setBlock(result.BlockHash)
+		}
+		if _, err := getMempoolEntry(t.txid); err == nil {
+			s.State = stateMempool
+			return s, nil
+		}
+	}
+
+	if unconfirmed != nil && unconfirmed.ReplacedBy != "" {
+		s.State = stateConflicted
+		s.Conflicts = append(unconfirmed.WalletConflicts, unconfirmed.ReplacedBy)
+		return s, nil
+	}
+	if unconfirmed == nil {
+		found, err := t.scanBlocks(s)
+		if err != nil || found {
+			return s, err
+		}
+	}
+	if t.tx != nil {
+		unspent, err := inputsUnspent(t.tx)
+		if err != nil {
+			return s, err
+		}
+		if unspent {
+			s.State = stateDropped
+			return s, nil
+		}
+		return s, t.inputSpent(s, unconfirmed)
+	}
+	return s, nil
+}
+
+// Tells why an input of the tx is spent: the tx itself was mined since
+// check looked it up, or another tx spent the input. The node is asked again
+// before calling it a conflict.
+func (t *txTracker) inputSpent(s *txStatus, unconfirmed *walletTx) error {
+	if result, err := getRawTransaction(t.txid, ""); err == nil && result.BlockHash != "" {
+		return s.setBlock(result.BlockHash)
+	}
+	switch {
+	case unconfirmed != nil:
+		wtx, err := getWalletTxInfo(t.txid)
+		if err != nil {
+			return err
+		}
+		if wtx.Confirmations > 0 {
+			return s.setBlock(wtx.BlockHash)
+		}
+		s.State, s.Conflicts = stateConflicted, wtx.WalletConflicts
+	case t.since > 0:
+		found, err := t.scanBlocks(s)
+		if err != nil || found {
+			return err
+		}
+		s.State = stateConflicted
+	default:
+		// Without the wallet, -txindex or blocks to search, a confirmed tx
+		// looks like a conflicted one
+		return fmt.Errorf("an input of %s is spent, by the tx itself or a conflicting one: "+
+			"pass --since to search the blocks", t.txid)
+	}
+	return nil
+}
+
+func (s *txStatus) print(asJSON bool) {
+	if asJSON {
+		data, _ := json.Marshal(s)
+		fmt.Println(string(data))
+		return
+	}
+	switch s.State {
+	case stateConfirmed:
+		fmt.Printf("%s confirmed in block %d (%s) at position %d, %d confirmations\n",
+			s.Txid, s.BlockHeight, s.BlockHash, s.Position, s.Confirmations)
+	case stateConflicted:
+		fmt.Printf("%s conflicted, an input was spent by another tx %v\n", s.Txid, s.Conflicts)
+	case stateDropped:
+		fmt.Printf("%s dropped from the mempool, its inputs are unspent\n", s.Txid)
+	default:
+		fmt.Printf("%s %s\n", s.Txid, s.State)
+	}
+}
+
+// Polls until the tx has confirmations, reporting every state change.
+// Conflicts and drops fail at once, an unknown tx only at the timeout:
+// it may not have reached the node yet.
+func (t *txTracker) wait(confirmations int64, timeout, interval time.Duration, asJSON bool) (*txStatus, error) {
+	deadline := time.Now().Add(timeout)
+	var last *txStatus
+	for {
+		s, err := t.check()
+		if err != nil {
+			logger.Warn("status check failed", "txid", t.txid, "err", err)
+		} else {
+			if last == nil || s.State != last.State || s.Confirmations != last.Confirmations {
+				s.print(asJSON)
+			}
+			last = s
+			switch {
+			case s.State == stateConfirmed && s.Confirmations >= confirmations:
+				return s, nil
+			case s.State == stateConflicted || s.State == stateDropped:
+				return s, fmt.Errorf("tx %s %s", t.txid, s.State)
+			}
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return last, fmt.Errorf("tx %s not confirmed %d times after %s", t.txid, confirmations, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Runs status or send's --wait on txid, exits 1 unless the tx is in the
+// mempool or confirmed (with --wait: confirmed enough)
+func trackTx(c *cli.Context, txid string, since int64) {
+	t := &txTracker{txid: txid, since: since}
+	asJSON := c.Bool("json")
+	if c.Bool("wait") {
+		if _, err := t.wait(int64(c.Int("confirmations")), c.Duration("timeout"), c.Duration("interval"), asJSON); err != nil {
+			logger.Crit(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	s, err := t.check()
+	if err != nil {
+		logger.Crit(err.Error())
+		os.Exit(1)
+	}
+	s.print(asJSON)
+	if s.State != stateMempool && s.State != stateConfirmed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/libreoscar/btcwatch/addr"
+	"github.com/libreoscar/btcwatch/nulldata"
+	"io"
+)
+
+// What is shown before asking to broadcast a tx
+type txSummary struct {
+	tx           *wire.MsgTx
+	inputAmounts []btcutil.Amount // nil when unknown, e.g. a foreign psbt
+	changeIndex  int              // -1 without change
+	// Dry run: the change address isn't drawn from the wallet yet
+	changeUnknown bool
+	vsize         int64
+	rate          string // how the fee rate was picked, empty if it wasn't
+}
+
+func (s *txSummary) print(w io.Writer) {
+	fmt.Fprintln(w, "Transaction")
+	fmt.Fprintln(w, "  Inputs:")
+	for i, txIn := range s.tx.TxIn {
+		amount := "unknown amount"
+		if i < len(s.inputAmounts) {
+			amount = s.inputAmounts[i].String()
+		}
+		fmt.Fprintf(w, "    %d  %s  %s\n", i, txIn.PreviousOutPoint.String(), amount)
+	}
+
+	fmt.Fprintln(w, "  Outputs:")
+	var outTotal btcutil.Amount
+	var messages [][]byte
+	for i, txOut := range s.tx.TxOut {
+		outTotal += btcutil.Amount(txOut.Value)
+		value := btcutil.Amount(txOut.Value).String()
+		if pushes, err := nulldata.Parse(txOut.PkScript); err == nil {
+			fmt.Fprintf(w, "    %d  %s  OP_RETURN\n", i, value)
+			messages = append(messages, pushes...)
+			continue
+		}
+		to := fmt.Sprintf("script %x", txOut.PkScript)
+		if a := addr.NewAddrFromPkScript(txOut.PkScript, netParams); a != nil {
+			to = a.String()
+		}
+		if i == s.changeIndex && s.changeUnknown {
+			to = "a fresh wallet address (change)"
+		} else if i == s.changeIndex {
+			to += " (change)"
+		}
+		fmt.Fprintf(w, "    %d  %s  to %s\n", i, value, to)
+	}
+
+	for _, msg := range messages {
+		fmt.Fprintf(w, "  Message: %d bytes\n", len(msg))
+		fmt.Fprintf(w, "    hex:   %s\n", hex.EncodeToString(msg))
+		fmt.Fprintf(w, "    ascii: %s\n", printable(msg))
+	}
+
+	if len(s.inputAmounts) == len(s.tx.TxIn) {
+		var inTotal btcutil.Amount
+		for _, amount := range s.inputAmounts {
+			inTotal += amount
+		}
+		fee := inTotal - outTotal
+		fmt.Fprintf(w, "  Fee: %d sat (%s)", int64(fee), fee)
+		if s.vsize > 0 {
+			fmt.Fprintf(w, " for %d vB, %.2f sat/vB", s.vsize, float64(fee)/float64(s.vsize))
+		}
+		if s.rate != "" {
+			fmt.Fprintf(w, " (rate from %s)", s.rate)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// msg with every byte outside printable ASCII shown as a dot
+func printable(msg []byte) string {
+	out := make([]byte, len(msg))
+	for i, b := range msg {
+		if b < 0x20 || b > 0x7e {
+			b = '.'
+		}
+		out[i] = b
+	}
+	return string(out)
+}
@@ -0,0 +1,115 @@
+package psbt
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// SetRedeemScript records the script a P2SH input spends, which Finalize
+// needs for P2SH-P2WPKH. It must hash to the P2SH output: a wrong one would
+// only show when the tx is refused.
+func (p *Packet) SetRedeemScript(i int, script []byte) error {
+	prevScript, err := p.prevScript(i)
+	if err != nil {
+		return err
+	}
+	if !isP2SH(prevScript) {
+		return fmt.Errorf("input %d: %x isn't P2SH", i, prevScript)
+	}
+	if !bytes.Equal(btcutil.Hash160(script), prevScript[2:22]) {
+		return fmt.Errorf("input %d: redeem script %x doesn't hash to %x", i, script, prevScript)
+	}
+	p.Inputs[i].RedeemScript = script
+	return nil
+}
+
+// Finalize builds the final scriptSig or witness of every input not yet
+// finalized from its partial signature, for the single key scripts the
+// opreturn tool spends: P2PKH, P2WPKH and P2SH-P2WPKH. Signers that
+// finalize themselves need no help.
+func (p *Packet) Finalize() error {
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.isFinal() {
+			continue
+		}
+		if len(in.PartialSigs) != 1 {
+			return fmt.Errorf("input %d: %d partial signatures, want 1", i, len(in.PartialSigs))
+		}
+		sig := in.PartialSigs[0]
+		prevScript, err := p.prevScript(i)
+		if err != nil {
+			return err
+		}
+		switch {
+		case isP2WPKH(prevScript):
+			in.FinalScriptWitness = [][]byte{sig.Signature, sig.PubKey}
+		case isP2SH(prevScript) && isP2WPKH(in.RedeemScript):
+			in.FinalScriptSig = push(in.RedeemScript)
+			in.FinalScriptWitness = [][]byte{sig.Signature, sig.PubKey}
+		case isP2PKH(prevScript):
+			in.FinalScriptSig = append(push(sig.Signature), push(sig.PubKey)...)
+		default:
+			return fmt.Errorf("input %d: can't finalize script %x", i, prevScript)
+		}
+		// BIP174: the finalizer clears everything but the utxo
+		in.PartialSigs = nil
+		in.SighashType = 0
+		in.RedeemScript = nil
+		in.WitnessScript = nil
+		in.Bip32Derivation = nil
+	}
+	return nil
+}
+
+// Extract returns the signed tx of a finalized PSBT
+func (p *Packet) Extract() (*wire.MsgTx, error) {
+	tx := p.UnsignedTx.Copy()
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if !in.isFinal() {
+			return nil, fmt.Errorf("input %d isn't finalized", i)
+		}
+		tx.TxIn[i].SignatureScript = in.FinalScriptSig
+		tx.TxIn[i].Witness = in.FinalScriptWitness
+	}
+	return tx, nil
+}
+
+func (in *Input) isFinal() bool {
+	return in.FinalScriptSig != nil || in.FinalScriptWitness != nil
+}
+
+// The pk_script of the output spent by input i
+func (p *Packet) prevScript(i int) ([]byte, error) {
+	in := &p.Inputs[i]
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo.PkScript, nil
+	}
+	if in.NonWitnessUtxo != nil {
+		index := p.UnsignedTx.TxIn[i].PreviousOutPoint.Index
+		if int(index) < len(in.NonWitnessUtxo.TxOut) {
+			return in.NonWitnessUtxo.TxOut[index].PkScript, nil
+		}
+	}
+	return nil, fmt.Errorf("input %d: no utxo", i)
+}
+
+func isP2PKH(s []byte) bool {
+	return len(s) == 25 && s[0] == 0x76 && s[1] == 0xa9 && s[2] == 0x14 && s[23] == 0x88 && s[24] == 0xac
+}
+
+func isP2WPKH(s []byte) bool {
+	return len(s) == 22 && s[0] == 0x00 && s[1] == 0x14
+}
+
+func isP2SH(s []byte) bool {
+	return len(s) == 23 && s[0] == 0xa9 && s[1] == 0x14 && s[22] == 0x87
+}
+
+// Signatures, pubkeys and redeem scripts all fit a direct push
+func push(data []byte) []byte {
+	return append([]byte{byte(len(data))}, data...)
+}
@@ -0,0 +1,414 @@
+// Package psbt reads and writes BIP174 partially signed bitcoin
+// transactions, so the opreturn tool can hand its txs to hardware wallets
+// and offline signers, and broadcast what they send back.
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/wire"
+	"io"
+	"sort"
+)
+
+var magic = []byte{'p', 's', 'b', 't', 0xff}
+
+// Key types, BIP174 "Specification"
+const (
+	globalUnsignedTx = 0x00
+
+	inNonWitnessUtxo     = 0x00
+	inWitnessUtxo        = 0x01
+	inPartialSig         = 0x02
+	inSighashType        = 0x03
+	inRedeemScript       = 0x04
+	inWitnessScript      = 0x05
+	inBip32Derivation    = 0x06
+	inFinalScriptSig     = 0x07
+	inFinalScriptWitness = 0x08
+
+	outRedeemScript    = 0x00
+	outWitnessScript   = 0x01
+	outBip32Derivation = 0x02
+)
+
+// Bounds what a single key or value may claim, a PSBT is well below that
+const maxFieldSize = 4000000
+
+var ErrInvalid = errors.New("invalid psbt")
+
+// An unparsed key/value pair, kept so a round trip doesn't lose the fields
+// of other software
+type KV struct {
+	Key   []byte
+	Value []byte
+}
+
+type Bip32Derivation struct {
+	PubKey      []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte // DER, sighash byte included
+}
+
+type Input struct {
+	NonWitnessUtxo     *wire.MsgTx
+	WitnessUtxo        *wire.TxOut
+	PartialSigs        []PartialSig
+	SighashType        uint32 // 0 when not set
+	RedeemScript       []byte
+	WitnessScript      []byte
+	Bip32Derivation    []Bip32Derivation
+	FinalScriptSig     []byte
+	FinalScriptWitness [][]byte
+	Unknowns           []KV
+}
+
+type Output struct {
+	RedeemScript    []byte
+	WitnessScript   []byte
+	Bip32Derivation []Bip32Derivation
+	Unknowns        []KV
+}
+
+type Packet struct {
+	UnsignedTx *wire.MsgTx
+	Inputs     []Input
+	Outputs    []Output
+	Unknowns   []KV
+}
+
+// New returns an empty PSBT for tx, which must not be signed
+func New(tx *wire.MsgTx) (*Packet, error) {
+	for i, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) > 0 {
+			return nil, fmt.Errorf("%s: input %d is signed", ErrInvalid, i)
+		}
+	}
+	return &Packet{
+		UnsignedTx: tx,
+		Inputs:     make([]Input, len(tx.TxIn)),
+		Outputs:    make([]Output, len(tx.TxOut)),
+	}, nil
+}
+
+// Decode reads a PSBT in binary or base64, as signers write them
+func Decode(data []byte) (*Packet, error) {
+	if !bytes.HasPrefix(data, magic) {
+		raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: neither binary nor base64", ErrInvalid)
+		}
+		data = raw
+	}
+	return Parse(bytes.NewReader(data))
+}
+
+func (p *Packet) B64Encode() (string, error) {
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func (p *Packet) Serialize(w io.Writer) error {
+	if _, err := w.Write(magic); err != nil {
+		return err
+	}
+	var tx bytes.Buffer
+	if err := p.UnsignedTx.Serialize(&tx); err != nil {
+		return err
+	}
+	if err := writeKV(w, []byte{globalUnsignedTx}, tx.Bytes()); err != nil {
+		return err
+	}
+	if err := writeMap(w, nil, p.Unknowns); err != nil {
+		return err
+	}
+	for i := range p.Inputs {
+		kvs, err := p.Inputs[i].kvs()
+		if err != nil {
+			return err
+		}
+		if err := writeMap(w, kvs, p.Inputs[i].Unknowns); err != nil {
+			return err
+		}
+	}
+	for i := range p.Outputs {
+		if err := writeMap(w, p.Outputs[i].kvs(), p.Outputs[i].Unknowns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *Input) kvs() ([]KV, error) {
+	var kvs []KV
+	if in.NonWitnessUtxo != nil {
+		var buf bytes.Buffer
+		if err := in.NonWitnessUtxo.Serialize(&buf); err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, KV{[]byte{inNonWitnessUtxo}, buf.Bytes()})
+	}
+	if in.WitnessUtxo != nil {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, in.WitnessUtxo.Value)
+		wire.WriteVarBytes(&buf, 0, in.WitnessUtxo.PkScript)
+		kvs = append(kvs, KV{[]byte{inWitnessUtxo}, buf.Bytes()})
+	}
+	for _, sig := range in.PartialSigs {
+		kvs = append(kvs, KV{append([]byte{inPartialSig}, sig.PubKey...), sig.Signature})
+	}
+	if in.SighashType != 0 {
+		v := make([]byte, 4)
+		binary.LittleEndian.PutUint32(v, in.SighashType)
+		kvs = append(kvs, KV{[]byte{inSighashType}, v})
+	}
+	if in.RedeemScript != nil {
+		kvs = append(kvs, KV{[]byte{inRedeemScript}, in.RedeemScript})
+	}
+	if in.WitnessScript != nil {
+		kvs = append(kvs, KV{[]byte{inWitnessScript}, in.WitnessScript})
+	}
+	kvs = append(kvs, derivationKVs(inBip32Derivation, in.Bip32Derivation)...)
+	if in.FinalScriptSig != nil {
+		kvs = append(kvs, KV{[]byte{inFinalScriptSig}, in.FinalScriptSig})
+	}
+	if in.FinalScriptWitness != nil {
+		var buf bytes.Buffer
+		wire.WriteVarInt(&buf, 0, uint64(len(in.FinalScriptWitness)))
+		for _, item := range in.FinalScriptWitness {
+			wire.WriteVarBytes(&buf, 0, item)
+		}
+		kvs = append(kvs, KV{[]byte{inFinalScriptWitness}, buf.Bytes()})
+	}
+	return kvs, nil
+}
+
+func (out *Output) kvs() []KV {
+	var kvs []KV
+	if out.RedeemScript != nil {
+		kvs = append(kvs, KV{[]byte{outRedeemScript}, out.RedeemScript})
+	}
+	if out.WitnessScript != nil {
+		kvs = append(kvs, KV{[]byte{outWitnessScript}, out.WitnessScript})
+	}
+	return append(kvs, derivationKVs(outBip32Derivation, out.Bip32Derivation)...)
+}
+
+func derivationKVs(keyType byte, derivations []Bip32Derivation) []KV {
+	var kvs []KV
+	for _, d := range derivations {
+		v := make([]byte, 4+4*len(d.Path))
+		binary.LittleEndian.PutUint32(v, d.Fingerprint)
+		for i, index := range d.Path {
+			binary.LittleEndian.PutUint32(v[4+4*i:], index)
+		}
+		kvs = append(kvs, KV{append([]byte{keyType}, d.PubKey...), v})
+	}
+	return kvs
+}
+
+// Writes known then unknown pairs, unknowns sorted for a stable output,
+// and the map separator
+func writeMap(w io.Writer, known, unknowns []KV) error {
+	sorted := append([]KV(nil), unknowns...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].Key, sorted[j].Key) < 0 })
+	for _, kv := range append(known, sorted...) {
+		if err := writeKV(w, kv.Key, kv.Value); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0x00})
+	return err
+}
+
+func writeKV(w io.Writer, key, value []byte) error {
+	if err := wire.WriteVarBytes(w, 0, key); err != nil {
+		return err
+	}
+	return wire.WriteVarBytes(w, 0, value)
+}
+
+func Parse(r io.Reader) (*Packet, error) {
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, head); err != nil || !bytes.Equal(head, magic) {
+		return nil, fmt.Errorf("%s: bad magic", ErrInvalid)
+	}
+	global, err := readMap(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &Packet{}
+	for _, kv := range global {
+		if len(kv.Key) == 1 && kv.Key[0] == globalUnsignedTx {
+			tx := &wire.MsgTx{}
+			if err := tx.Deserialize(bytes.NewReader(kv.Value)); err != nil {
+				return nil, fmt.Errorf("%s: unsigned tx: %s", ErrInvalid, err)
+			}
+			p.UnsignedTx = tx
+		} else {
+			p.Unknowns = append(p.Unknowns, kv)
+		}
+	}
+	if p.UnsignedTx == nil {
+		return nil, fmt.Errorf("%s: no unsigned tx", ErrInvalid)
+	}
+	for i, txIn := range p.UnsignedTx.TxIn {
+		if len(txIn.SignatureScript) > 0 {
+			return nil, fmt.Errorf("%s: unsigned tx input %d has a scriptSig", ErrInvalid, i)
+		}
+	}
+
+	p.Inputs = make([]Input, len(p.UnsignedTx.TxIn))
+	for i := range p.Inputs {
+		kvs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Inputs[i].parse(kvs); err != nil {
+			return nil, fmt.Errorf("input %d: %s", i, err)
+		}
+	}
+	p.Outputs = make([]Output, len(p.UnsignedTx.TxOut))
+	for i := range p.Outputs {
+		kvs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Outputs[i].parse(kvs); err != nil {
+			return nil, fmt.Errorf("output %d: %s", i, err)
+		}
+	}
+	return p, nil
+}
+
+func (in *Input) parse(kvs []KV) error {
+	for _, kv := range kvs {
+		keyType, keyData := kv.Key[0], kv.Key[1:]
+		if keyType > inFinalScriptWitness || (len(keyData) > 0 && keyType != inPartialSig && keyType != inBip32Derivation) {
+			in.Unknowns = append(in.Unknowns, kv)
+			continue
+		}
+		switch keyType {
+		case inNonWitnessUtxo:
+			tx := &wire.MsgTx{}
+			if err := tx.Deserialize(bytes.NewReader(kv.Value)); err != nil {
+				return fmt.Errorf("%s: non-witness utxo: %s", ErrInvalid, err)
+			}
+			in.NonWitnessUtxo = tx
+		case inWitnessUtxo:
+			r := bytes.NewReader(kv.Value)
+			var value int64
+			if err := binary.Read(r, binary.LittleEndian, &value); err != nil {
+				return fmt.Errorf("%s: witness utxo: %s", ErrInvalid, err)
+			}
+			script, err := wire.ReadVarBytes(r, 0, maxFieldSize, "pkScript")
+			if err != nil || r.Len() != 0 {
+				return fmt.Errorf("%s: witness utxo script", ErrInvalid)
+			}
+			in.WitnessUtxo = &wire.TxOut{Value: value, PkScript: script}
+		case inPartialSig:
+			if len(keyData) != 33 && len(keyData) != 65 {
+				return fmt.Errorf("%s: partial sig pubkey of %d bytes", ErrInvalid, len(keyData))
+			}
+			in.PartialSigs = append(in.PartialSigs, PartialSig{keyData, kv.Value})
+		case inSighashType:
+			if len(kv.Value) != 4 {
+				return fmt.Errorf("%s: sighash type", ErrInvalid)
+			}
+			in.SighashType = binary.LittleEndian.Uint32(kv.Value)
+		case inRedeemScript:
+			in.RedeemScript = kv.Value
+		case inWitnessScript:
+			in.WitnessScript = kv.Value
+		case inBip32Derivation:
+			d, err := parseDerivation(keyData, kv.Value)
+			if err != nil {
+				return err
+			}
+			in.Bip32Derivation = append(in.Bip32Derivation, d)
+		case inFinalScriptSig:
+			in.FinalScriptSig = kv.Value
+		case inFinalScriptWitness:
+			r := bytes.NewReader(kv.Value)
+			n, err := wire.ReadVarInt(r, 0)
+			if err != nil || n > uint64(len(kv.Value)) {
+				return fmt.Errorf("%s: final script witness", ErrInvalid)
+			}
+			witness := make([][]byte, n)
+			for i := range witness {
+				if witness[i], err = wire.ReadVarBytes(r, 0, maxFieldSize, "witness"); err != nil {
+					return fmt.Errorf("%s: final script witness", ErrInvalid)
+				}
+			}
+			in.FinalScriptWitness = witness
+		}
+	}
+	return nil
+}
+
+func (out *Output) parse(kvs []KV) error {
+	for _, kv := range kvs {
+		keyType, keyData := kv.Key[0], kv.Key[1:]
+		switch {
+		case keyType == outRedeemScript && len(keyData) == 0:
+			out.RedeemScript = kv.Value
+		case keyType == outWitnessScript && len(keyData) == 0:
+			out.WitnessScript = kv.Value
+		case keyType == outBip32Derivation:
+			d, err := parseDerivation(keyData, kv.Value)
+			if err != nil {
+				return err
+			}
+			out.Bip32Derivation = append(out.Bip32Derivation, d)
+		default:
+			out.Unknowns = append(out.Unknowns, kv)
+		}
+	}
+	return nil
+}
+
+func parseDerivation(pubKey, value []byte) (Bip32Derivation, error) {
+	if (len(pubKey) != 33 && len(pubKey) != 65) || len(value) < 4 || len(value)%4 != 0 {
+		return Bip32Derivation{}, fmt.Errorf("%s: bip32 derivation", ErrInvalid)
+	}
+	d := Bip32Derivation{PubKey: pubKey, Fingerprint: binary.LittleEndian.Uint32(value)}
+	for i := 4; i < len(value); i += 4 {
+		d.Path = append(d.Path, binary.LittleEndian.Uint32(value[i:]))
+	}
+	return d, nil
+}
+
+// Reads key/value pairs up to the map separator, rejecting duplicate keys
+func readMap(r io.Reader) ([]KV, error) {
+	var kvs []KV
+	seen := make(map[string]bool)
+	for {
+		key, err := wire.ReadVarBytes(r, 0, maxFieldSize, "key")
+		if err != nil {
+			return nil, fmt.Errorf("%s: truncated", ErrInvalid)
+		}
+		if len(key) == 0 {
+			return kvs, nil
+		}
+		if seen[string(key)] {
+			return nil, fmt.Errorf("%s: duplicate key %x", ErrInvalid, key)
+		}
+		seen[string(key)] = true
+		value, err := wire.ReadVarBytes(r, 0, maxFieldSize, "value")
+		if err != nil {
+			return nil, fmt.Errorf("%s: truncated", ErrInvalid)
+		}
+		kvs = append(kvs, KV{key, value})
+	}
+}
@@ -0,0 +1,223 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"strings"
+	"testing"
+)
+
+var (
+	// Version 2, spending output 0 of 1111..11 to a 1000 sat OP_RETURN
+	unsignedTxHex = "02000000" + "01" + strings.Repeat("11", 32) + "00000000" + "00" + "ffffffff" +
+		"01" + "e803000000000000" + "036a0142" + "00000000"
+	p2wpkhScriptHex = "0014" + strings.Repeat("22", 20)
+	p2pkhScriptHex  = "76a914" + strings.Repeat("33", 20) + "88ac"
+
+	pubKey = append([]byte{0x02}, bytes.Repeat([]byte{0x44}, 32)...)
+	sig    = append(bytes.Repeat([]byte{0x30}, 71), 0x01)
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func unsignedTx(t *testing.T) *wire.MsgTx {
+	tx := &wire.MsgTx{}
+	if err := tx.Deserialize(bytes.NewReader(mustHex(unsignedTxHex))); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestSerialize(t *testing.T) {
+	p, err := New(unsignedTx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Inputs[0].WitnessUtxo = &wire.TxOut{Value: 100000, PkScript: mustHex(p2wpkhScriptHex)}
+
+	// Laid out by hand from BIP174
+	want := "70736274ff" +
+		"0100" + "3f" + unsignedTxHex + "00" +
+		"0101" + "1f" + "a086010000000000" + "16" + p2wpkhScriptHex + "00" +
+		"00"
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(buf.Bytes()) != want {
+		t.Fatal("wrong psbt", hex.EncodeToString(buf.Bytes()))
+	}
+
+	b64, err := p.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{buf.Bytes(), []byte(b64 + "\n")} {
+		parsed, err := Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var again bytes.Buffer
+		parsed.Serialize(&again)
+		if !bytes.Equal(again.Bytes(), buf.Bytes()) {
+			t.Error("round trip changed the psbt", hex.EncodeToString(again.Bytes()))
+		}
+	}
+}
+
+func TestRoundTripFields(t *testing.T) {
+	p, _ := New(unsignedTx(t))
+	p.Unknowns = []KV{{[]byte{0xfb}, []byte{0, 0, 0, 0}}}
+	p.Inputs[0] = Input{
+		NonWitnessUtxo:  unsignedTx(t),
+		PartialSigs:     []PartialSig{{pubKey, sig}},
+		SighashType:     1,
+		RedeemScript:    mustHex(p2wpkhScriptHex),
+		Bip32Derivation: []Bip32Derivation{{pubKey, 0xdeadbeef, []uint32{0x80000054, 0x80000000, 0x80000000, 0, 7}}},
+		Unknowns:        []KV{{[]byte{0xfc, 0x01}, []byte("proprietary")}},
+	}
+	p.Outputs[0].Bip32Derivation = []Bip32Derivation{{pubKey, 1, []uint32{1, 2}}}
+
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := parsed.Inputs[0]
+	if in.NonWitnessUtxo == nil || len(in.PartialSigs) != 1 || !bytes.Equal(in.PartialSigs[0].Signature, sig) ||
+		in.SighashType != 1 || hex.EncodeToString(in.RedeemScript) != p2wpkhScriptHex ||
+		len(in.Bip32Derivation) != 1 || in.Bip32Derivation[0].Fingerprint != 0xdeadbeef ||
+		len(in.Bip32Derivation[0].Path) != 5 || in.Bip32Derivation[0].Path[4] != 7 ||
+		len(in.Unknowns) != 1 || len(parsed.Unknowns) != 1 {
+		t.Errorf("input fields lost: %+v", in)
+	}
+	if d := parsed.Outputs[0].Bip32Derivation; len(d) != 1 || d[0].Path[1] != 2 {
+		t.Errorf("output fields lost: %+v", parsed.Outputs[0])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tx := unsignedTxHex
+	signed := strings.Replace(tx, "00"+"ffffffff", "0151"+"ffffffff", 1)
+	for name, data := range map[string]string{
+		"bad magic":        "70736274fe0100",
+		"no unsigned tx":   "70736274ff00",
+		"duplicate key":    "70736274ff" + "0100" + "3f" + tx + "0100" + "3f" + tx + "00",
+		"truncated":        "70736274ff" + "0100" + "3f" + tx,
+		"no input map":     "70736274ff" + "0100" + "3f" + tx + "00",
+		"signed tx":        "70736274ff" + "0100" + "40" + signed + "00" + "00" + "00",
+		"bad sighash":      "70736274ff" + "0100" + "3f" + tx + "00" + "0103" + "0101" + "00" + "00",
+		"bad witness utxo": "70736274ff" + "0100" + "3f" + tx + "00" + "0101" + "0201ff" + "00" + "00",
+	} {
+		if _, err := Decode(mustHex(data)); err == nil {
+			t.Error(name, "parsed")
+		}
+	}
+	if _, err := Decode([]byte("not a psbt")); err == nil {
+		t.Error("garbage parsed")
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	prevTx := unsignedTx(t)
+	prevTx.TxOut[0].PkScript = mustHex(p2pkhScriptHex)
+
+	var tests = []struct {
+		name      string
+		in        Input
+		scriptSig string
+		witness   int
+	}{
+		{"p2wpkh", Input{WitnessUtxo: &wire.TxOut{Value: 1, PkScript: mustHex(p2wpkhScriptHex)}},
+			"", 2},
+		{"p2sh-p2wpkh", Input{WitnessUtxo: &wire.TxOut{Value: 1, PkScript: mustHex("a914" + strings.Repeat("55", 20) + "87")},
+			RedeemScript: mustHex(p2wpkhScriptHex)}, "16" + p2wpkhScriptHex, 2},
+		{"p2pkh", Input{NonWitnessUtxo: prevTx},
+			"48" + hex.EncodeToString(sig) + "21" + hex.EncodeToString(pubKey), 0},
+	}
+	for _, test := range tests {
+		p, _ := New(unsignedTx(t))
+		p.Inputs[0] = test.in
+		p.Inputs[0].PartialSigs = []PartialSig{{pubKey, sig}}
+		if _, err := p.Extract(); err == nil {
+			t.Error(test.name, "extracted before finalizing")
+		}
+		if err := p.Finalize(); err != nil {
+			t.Error(test.name, err)
+			continue
+		}
+		if p.Inputs[0].PartialSigs != nil || p.Inputs[0].RedeemScript != nil {
+			t.Error(test.name, "signing fields kept")
+		}
+		tx, err := p.Extract()
+		if err != nil {
+			t.Error(test.name, err)
+			continue
+		}
+		if hex.EncodeToString(tx.TxIn[0].SignatureScript) != test.scriptSig || len(tx.TxIn[0].Witness) != test.witness {
+			t.Error(test.name, "wrong input", hex.EncodeToString(tx.TxIn[0].SignatureScript), len(tx.TxIn[0].Witness))
+		}
+		if len(p.UnsignedTx.TxIn[0].SignatureScript) != 0 {
+			t.Error(test.name, "Extract modified the unsigned tx")
+		}
+	}
+
+	p, _ := New(unsignedTx(t))
+	p.Inputs[0].WitnessUtxo = &wire.TxOut{Value: 1, PkScript: mustHex(p2wpkhScriptHex)}
+	if err := p.Finalize(); err == nil {
+		t.Error("finalized without signature")
+	}
+	p.Inputs[0].WitnessUtxo.PkScript = mustHex("a820" + strings.Repeat("66", 32) + "87")
+	p.Inputs[0].PartialSigs = []PartialSig{{pubKey, sig}}
+	if err := p.Finalize(); err == nil {
+		t.Error("finalized a hash lock")
+	}
+}
+
+func TestFinalizeP2SHP2WPKH(t *testing.T) {
+	redeemScript := mustHex(p2wpkhScriptHex)
+	p2shScript := append(append([]byte{0xa9, 0x14}, btcutil.Hash160(redeemScript)...), 0x87)
+	prevTx := unsignedTx(t)
+	prevTx.TxOut[0].PkScript = p2shScript
+
+	// Only the full prev tx, as for inputs the wallet has no witness utxo of
+	p, _ := New(unsignedTx(t))
+	p.Inputs[0].NonWitnessUtxo = prevTx
+	p.Inputs[0].PartialSigs = []PartialSig{{pubKey, sig}}
+	if err := p.SetRedeemScript(0, mustHex(p2pkhScriptHex)); err == nil {
+		t.Error("accepted a redeem script of another P2SH")
+	}
+	if err := p.Finalize(); err == nil {
+		t.Error("finalized without redeem script")
+	}
+	if err := p.SetRedeemScript(0, redeemScript); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := p.Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(tx.TxIn[0].SignatureScript) != "16"+p2wpkhScriptHex || len(tx.TxIn[0].Witness) != 2 {
+		t.Error("wrong input", hex.EncodeToString(tx.TxIn[0].SignatureScript), len(tx.TxIn[0].Witness))
+	}
+
+	p, _ = New(unsignedTx(t))
+	p.Inputs[0].WitnessUtxo = &wire.TxOut{Value: 1, PkScript: mustHex(p2wpkhScriptHex)}
+	if err := p.SetRedeemScript(0, redeemScript); err == nil {
+		t.Error("set a redeem script on a P2WPKH input")
+	}
+}
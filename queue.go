@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// How many published block hashes are remembered to drop duplicates
+const seenHashes = 1000
+
+// blockQueue serializes block processing: notifications only wake up a single
+// consumer, which then walks every height from the last processed block up
+// to the node tip, in order. A burst of notifications collapses into one run.
+type blockQueue struct {
+	trigger chan struct{}
+	done    chan struct{}
+
+	// Hashes already published, oldest first
+	seen      map[string]bool
+	seenOrder []string
+
+	// Sinks that got the block a failed attempt is retrying, so that the
+	// retry doesn't republish to them. Blocks are processed in order and a
+	// failure stops the run, so there is at most one such block.
+	partialHash  string
+	partialSinks map[int]bool
+}
+
+func newBlockQueue() *blockQueue {
+	return &blockQueue{
+		trigger: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		seen:    make(map[string]bool),
+	}
+}
+
+// Asks the consumer to catch up with the node, never blocks
+func (q *blockQueue) notify() {
+	select {
+	case q.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Consumes notifications until ctx is done. The block being processed when
+// ctx is cancelled is finished first.
+func (q *blockQueue) run(ctx context.Context) {
+	defer close(q.done)
+	if cp := status.checkpoint(); cp != nil {
+		q.markSeen(cp.Hash)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.trigger:
+			if err := q.catchUp(ctx); err != nil && ctx.Err() == nil {
+				status.failed(err)
+				// Don't wait for the next block to retry
+				time.AfterFunc(conf.RPCRetry.MaxBackoff.Duration, q.notify)
+			}
+		}
+	}
+}
+
+// Waits for run to return, at most until ctx is done
+func (q *blockQueue) wait(ctx context.Context) error {
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("block queue didn't stop: %s", ctx.Err())
+	}
+}
+
+// Processes the blocks up to the tip. A block already started is finished
+// even if ctx is cancelled meanwhile: RPC retries are bounded by the policy.
+func (q *blockQueue) catchUp(ctx context.Context) error {
+	tip, err := getBlockCount(ctx)
+	if err != nil {
+		logger.Crit("getblockcount failed", "err", err)
+		return err
+	}
+	status.setTip(tip)
+	nodeTip.Set(float64(tip))
+
+	// Without a checkpoint only the tip is processed. When the tip isn't
+	// above the last block (reorg, duplicate notification) it is looked at
+	// again, the hash check drops it if it was already published.
+	from := tip
+	if cp := status.checkpoint(); cp != nil && cp.Height < tip {
+		from = cp.Height + 1
+	}
+	for height := from; height <= tip; height++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := q.process(context.Background(), height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *blockQueue) process(ctx context.Context, height int64) error {
+	blockHash, err := getBlockHash(ctx, height)
+	if err != nil {
+		logger.Crit("getblockhash failed", "height", height, "err", err)
+		return err
+	}
+	if q.seen[blockHash.String()] {
+		logger.Info("block already published, skipped", "height", height, "hash", blockHash.String())
+		return nil
+	}
+	if q.partialHash != blockHash.String() {
+		q.partialHash = blockHash.String()
+		q.partialSinks = make(map[int]bool)
+	}
+	if err := checkBlock(ctx, height, blockHash, q.partialSinks); err != nil {
+		return fmt.Errorf("block %d: %s", height, err)
+	}
+	q.partialHash, q.partialSinks = "", nil
+	q.markSeen(blockHash.String())
+	if err := persistCheckpoint(); err != nil {
+		logger.Crit("failed to save checkpoint", "err", err)
+	}
+	return nil
+}
+
+func (q *blockQueue) markSeen(hash string) {
+	if q.seen[hash] {
+		return
+	}
+	q.seen[hash] = true
+	q.seenOrder = append(q.seenOrder, hash)
+	if len(q.seenOrder) > seenHashes {
+		delete(q.seen, q.seenOrder[0])
+		q.seenOrder = q.seenOrder[1:]
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcutil"
+	"github.com/libreoscar/btcwatch/rpcretry"
+	"sync"
+)
+
+// bitcoind calls go through rpc, which retries them and rebuilds client when
+// the credentials change (bitcoind rewrites its cookie on restart)
+var rpc *rpcretry.Caller
+var clientMu sync.Mutex
+
+func rpcClient() *rpcclient.Client {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	return client
+}
+
+func connect() error {
+	connCfg, err := conf.rpcConf()
+	if err != nil {
+		return err
+	}
+	newClient, err := rpcclient.New(connCfg, nil)
+	if err != nil {
+		return err
+	}
+	clientMu.Lock()
+	old := client
+	client = newClient
+	clientMu.Unlock()
+	if old != nil {
+		old.Shutdown()
+	}
+	return nil
+}
+
+func newRPC() *rpcretry.Caller {
+	caller := rpcretry.NewCaller(conf.RPCRetry)
+	caller.Observe = observeRPC
+	caller.Reconnect = func() error {
+		logger.Warn("bitcoind refused the credentials, reconnecting")
+		return connect()
+	}
+	return caller
+}
+
+func getBlockCount(ctx context.Context) (int64, error) {
+	return rpcretry.Call(ctx, rpc, "getblockcount", func() (int64, error) {
+		return rpcClient().GetBlockCount()
+	})
+}
+
+func getBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	return rpcretry.Call(ctx, rpc, "getblockhash", func() (*chainhash.Hash, error) {
+		return rpcClient().GetBlockHash(height)
+	})
+}
+
+func getBlock(ctx context.Context, hash *chainhash.Hash) (*btcutil.Block, error) {
+	return rpcretry.Call(ctx, rpc, "getblock", func() (*btcutil.Block, error) {
+		block, err := rpcClient().GetBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		return btcutil.NewBlock(block), nil
+	})
+}
@@ -0,0 +1,97 @@
+// Package rpcauth resolves the credentials and TLS settings of the bitcoind
+// RPC connection, so they don't have to be stored in conf.json.
+package rpcauth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// bitcoind writes "__cookie__:<random password>" to <datadir>/.cookie when
+// no rpcpassword is configured
+const cookieUser = "__cookie__"
+
+// Conf is embedded in the config files of the binaries. Exactly one of Pass,
+// PassFile and CookieFile provides the password.
+type Conf struct {
+	User       string
+	Pass       string
+	PassFile   string // file holding the password only
+	CookieFile string // bitcoind's .cookie file, replaces User and Pass
+	TLS        bool
+	CertFile   string // CA certificate of the RPC server, PEM encoded
+}
+
+func (c *Conf) Validate() error {
+	sources := 0
+	for _, s := range []string{c.Pass, c.PassFile, c.CookieFile} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("only one of Pass, PassFile and CookieFile can be set")
+	}
+	if c.CookieFile != "" && c.User != "" {
+		return fmt.Errorf("User can't be set with CookieFile")
+	}
+	if c.CertFile != "" && !c.TLS {
+		return fmt.Errorf("CertFile is set but TLS is disabled")
+	}
+	return nil
+}
+
+// Credentials returns the user and password to authenticate with, reading
+// the files again on each call. The binaries call it when they connect; the
+// watcher also reconnects, and so calls it again, after bitcoind refuses the
+// credentials, e.g. when a restart rewrote the cookie.
+func (c *Conf) Credentials() (user, pass string, err error) {
+	switch {
+	case c.CookieFile != "":
+		return ReadCookie(c.CookieFile)
+	case c.PassFile != "":
+		data, err := ioutil.ReadFile(c.PassFile)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read password file: %s", err)
+		}
+		pass = strings.TrimRight(string(data), "\r\n")
+		if pass == "" {
+			return "", "", fmt.Errorf("password file %s is empty", c.PassFile)
+		}
+		return c.User, pass, nil
+	}
+	return c.User, c.Pass, nil
+}
+
+// Certificates returns the PEM encoded CA certificate, nil without one
+func (c *Conf) Certificates() ([]byte, error) {
+	if c.CertFile == "" {
+		return nil, nil
+	}
+	certs, err := ioutil.ReadFile(c.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RPC certificate: %s", err)
+	}
+	return certs, nil
+}
+
+func ReadCookie(path string) (user, pass string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read cookie file: %s", err)
+	}
+	return ParseCookie(string(data))
+}
+
+func ParseCookie(cookie string) (user, pass string, err error) {
+	cookie = strings.TrimRight(cookie, "\r\n")
+	parts := strings.SplitN(cookie, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("malformed cookie")
+	}
+	if parts[0] != cookieUser {
+		return "", "", fmt.Errorf("unexpected cookie user %q", parts[0])
+	}
+	return parts[0], parts[1], nil
+}
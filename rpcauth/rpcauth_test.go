@@ -0,0 +1,69 @@
+package rpcauth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCookie(t *testing.T) {
+	user, pass, err := ParseCookie("__cookie__:4e0b1c5d5f5a0b57c3fd2e87a2c66a1e\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "__cookie__" || pass != "4e0b1c5d5f5a0b57c3fd2e87a2c66a1e" {
+		t.Error("wrong credentials", user, pass)
+	}
+
+	for _, bad := range []string{"", "__cookie__", "__cookie__:", "alice:secret"} {
+		if _, _, err := ParseCookie(bad); err == nil {
+			t.Error("ParseCookie accepted", bad)
+		}
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpcauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passFile := filepath.Join(dir, "pass")
+	ioutil.WriteFile(passFile, []byte("s3cret\n"), 0600)
+	cookieFile := filepath.Join(dir, ".cookie")
+	ioutil.WriteFile(cookieFile, []byte("__cookie__:abcd"), 0600)
+
+	var tests = []struct {
+		conf Conf
+		user string
+		pass string
+	}{
+		{Conf{User: "alice", Pass: "plain"}, "alice", "plain"},
+		{Conf{User: "alice", PassFile: passFile}, "alice", "s3cret"},
+		{Conf{CookieFile: cookieFile}, "__cookie__", "abcd"},
+	}
+	for _, test := range tests {
+		if err := test.conf.Validate(); err != nil {
+			t.Error(err)
+			continue
+		}
+		user, pass, err := test.conf.Credentials()
+		if err != nil {
+			t.Error(err)
+		} else if user != test.user || pass != test.pass {
+			t.Error("wrong credentials", user, pass)
+		}
+	}
+
+	invalid := []Conf{
+		{User: "alice", Pass: "plain", PassFile: passFile},
+		{User: "alice", CookieFile: cookieFile},
+		{CertFile: "ca.pem"},
+	}
+	for _, conf := range invalid {
+		if conf.Validate() == nil {
+			t.Error("Validate accepted", conf)
+		}
+	}
+}
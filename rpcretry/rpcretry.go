@@ -0,0 +1,256 @@
+// Package rpcretry wraps the bitcoind RPC calls of both binaries with
+// retries, exponential backoff, per-call timeouts and a circuit breaker, so a
+// restarting node doesn't make us drop blocks or give up on a tx.
+package rpcretry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcjson"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bitcoind error codes worth waiting for
+const (
+	rpcClientNotConnected      = -9
+	rpcClientInInitialDownload = -10
+	rpcInWarmup                = -28
+)
+
+var ErrCircuitOpen = errors.New("bitcoind rpc circuit open")
+
+// Duration reads "1.5s"-style strings from the config files
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+type Policy struct {
+	MaxRetries       int      // attempts after the first one
+	InitialBackoff   Duration // doubled after every failed attempt
+	MaxBackoff       Duration
+	Timeout          Duration // of a single attempt, 0 waits forever
+	BreakerThreshold int      // failed calls in a row opening the circuit, 0 disables it
+	BreakerCooldown  Duration // how long an open circuit rejects calls
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxRetries:       5,
+		InitialBackoff:   Duration{500 * time.Millisecond},
+		MaxBackoff:       Duration{30 * time.Second},
+		Timeout:          Duration{time.Minute},
+		BreakerThreshold: 5,
+		BreakerCooldown:  Duration{time.Minute},
+	}
+}
+
+func (p *Policy) Validate() error {
+	if p.MaxRetries < 0 || p.BreakerThreshold < 0 {
+		return fmt.Errorf("MaxRetries and BreakerThreshold can't be negative")
+	}
+	if p.InitialBackoff.Duration < 0 || p.MaxBackoff.Duration < p.InitialBackoff.Duration {
+		return fmt.Errorf("MaxBackoff must be at least InitialBackoff")
+	}
+	if p.Timeout.Duration < 0 || p.BreakerCooldown.Duration < 0 {
+		return fmt.Errorf("Timeout and BreakerCooldown can't be negative")
+	}
+	return nil
+}
+
+type Class int
+
+const (
+	// Retrying may help: connection refused, timeout, node warming up...
+	Transient Class = iota
+	// The node rejected the request, retrying gives the same answer
+	Permanent
+	// The credentials were refused, e.g. the cookie changed on restart
+	Unauthorized
+)
+
+func Classify(err error) Class {
+	var rpcErr *btcjson.RPCError
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.Code {
+		case rpcClientNotConnected, rpcClientInInitialDownload, rpcInWarmup:
+			return Transient
+		}
+		return Permanent
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.Canceled) {
+		return Permanent
+	}
+	// rpcclient reports HTTP errors as plain strings
+	msg := err.Error()
+	if strings.Contains(msg, "status code: 401") || strings.Contains(msg, "status code: 403") {
+		return Unauthorized
+	}
+	// Everything else is the transport failing: refused connections,
+	// timeouts, EOF while bitcoind restarts, 5xx answers...
+	return Transient
+}
+
+// Caller runs RPC calls under a Policy. It is safe for concurrent use.
+type Caller struct {
+	Policy Policy
+	// Called after every attempt, e.g. to feed metrics
+	Observe func(method string, start time.Time, err error)
+	// Called on Unauthorized errors before retrying, to reload the
+	// credentials and rebuild the client
+	Reconnect func() error
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+	sleep     func(ctx context.Context, d time.Duration) error
+}
+
+func NewCaller(policy Policy) *Caller {
+	return &Caller{Policy: policy}
+}
+
+func (c *Caller) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *Caller) wait(ctx context.Context, d time.Duration) error {
+	if c.sleep != nil {
+		return c.sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Caller) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Policy.BreakerThreshold > 0 && c.clock().Before(c.openUntil) {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+func (c *Caller) record(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil || Classify(err) == Permanent {
+		// The node answered, it's up
+		c.failures = 0
+		c.openUntil = time.Time{}
+		return
+	}
+	c.failures++
+	// Once the cooldown is over a single failure opens the circuit again
+	halfOpen := !c.openUntil.IsZero()
+	if c.Policy.BreakerThreshold > 0 && (halfOpen || c.failures >= c.Policy.BreakerThreshold) {
+		c.openUntil = c.clock().Add(c.Policy.BreakerCooldown.Duration)
+		c.failures = 0
+	}
+}
+
+func (c *Caller) backoff(attempt int) time.Duration {
+	d := c.Policy.InitialBackoff.Duration
+	for i := 0; i < attempt && d < c.Policy.MaxBackoff.Duration; i++ {
+		d *= 2
+	}
+	if d > c.Policy.MaxBackoff.Duration {
+		d = c.Policy.MaxBackoff.Duration
+	}
+	return d
+}
+
+type result[T any] struct {
+	val T
+	err error
+}
+
+// Call runs fn until it succeeds, fails permanently, the retries are used
+// up or ctx is done. An attempt running past the timeout is abandoned: its
+// goroutine finishes in the background and its result is dropped.
+func Call[T any](ctx context.Context, c *Caller, method string, fn func() (T, error)) (T, error) {
+	var zero T
+	var lastErr error
+	for attempt := 0; attempt <= c.Policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := c.wait(ctx, c.backoff(attempt-1)); err != nil {
+				return zero, fmt.Errorf("%s: %s (last error: %s)", method, err, lastErr)
+			}
+		}
+		if err := c.allow(); err != nil {
+			return zero, fmt.Errorf("%s: %w", method, err)
+		}
+
+		start := time.Now()
+		val, err := callOnce(ctx, c.Policy.Timeout.Duration, fn)
+		if c.Observe != nil {
+			c.Observe(method, start, err)
+		}
+		c.record(err)
+		if err == nil {
+			return val, nil
+		}
+		lastErr = err
+		switch Classify(err) {
+		case Permanent:
+			return zero, err
+		case Unauthorized:
+			if c.Reconnect != nil {
+				if rerr := c.Reconnect(); rerr != nil {
+					return zero, fmt.Errorf("%s: reconnect failed: %s (after %s)", method, rerr, err)
+				}
+			}
+		}
+	}
+	return zero, fmt.Errorf("%s: giving up after %d attempts: %w", method, c.Policy.MaxRetries+1, lastErr)
+}
+
+func callOnce[T any](ctx context.Context, timeout time.Duration, fn func() (T, error)) (T, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	done := make(chan result[T], 1)
+	go func() {
+		val, err := fn()
+		done <- result[T]{val, err}
+	}()
+	select {
+	case r := <-done:
+		return r.val, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
@@ -0,0 +1,173 @@
+package rpcretry
+
+import (
+	"context"
+	"errors"
+	"github.com/btcsuite/btcd/btcjson"
+	"testing"
+	"time"
+)
+
+var errRefused = errors.New("dial tcp 127.0.0.1:8332: connect: connection refused")
+
+// Returns a caller that doesn't really sleep, recording the backoffs instead
+func testCaller(policy Policy) (*Caller, *[]time.Duration) {
+	var sleeps []time.Duration
+	c := NewCaller(policy)
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return ctx.Err()
+	}
+	return c, &sleeps
+}
+
+func TestClassify(t *testing.T) {
+	var tests = []struct {
+		err   error
+		class Class
+	}{
+		{errRefused, Transient},
+		{context.DeadlineExceeded, Transient},
+		{&btcjson.RPCError{Code: -28, Message: "Loading block index..."}, Transient},
+		{&btcjson.RPCError{Code: -8, Message: "Block height out of range"}, Permanent},
+		{errors.New("status code: 401, response: \"\""), Unauthorized},
+		{context.Canceled, Permanent},
+	}
+	for _, test := range tests {
+		if c := Classify(test.err); c != test.class {
+			t.Errorf("Classify(%v) = %d, want %d", test.err, c, test.class)
+		}
+	}
+}
+
+func TestRetryThenSuccess(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.BreakerThreshold = 0
+	c, sleeps := testCaller(policy)
+	calls := 0
+	val, err := Call(context.Background(), c, "getblockcount", func() (int64, error) {
+		calls++
+		if calls < 4 {
+			return 0, errRefused
+		}
+		return 420000, nil
+	})
+	if err != nil || val != 420000 {
+		t.Fatal("Call failed", val, err)
+	}
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}
+	if len(*sleeps) != len(want) {
+		t.Fatal("wrong backoffs", *sleeps)
+	}
+	for i := range want {
+		if (*sleeps)[i] != want[i] {
+			t.Error("wrong backoffs", *sleeps)
+		}
+	}
+}
+
+func TestBackoffCap(t *testing.T) {
+	c := NewCaller(DefaultPolicy())
+	if d := c.backoff(20); d != 30*time.Second {
+		t.Error("backoff not capped", d)
+	}
+}
+
+func TestPermanentNotRetried(t *testing.T) {
+	c, sleeps := testCaller(DefaultPolicy())
+	calls := 0
+	_, err := Call(context.Background(), c, "getblockhash", func() (string, error) {
+		calls++
+		return "", &btcjson.RPCError{Code: -8, Message: "Block height out of range"}
+	})
+	if err == nil || calls != 1 || len(*sleeps) != 0 {
+		t.Error("permanent error retried", calls, err)
+	}
+}
+
+func TestGiveUp(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.MaxRetries = 2
+	policy.BreakerThreshold = 0
+	c, _ := testCaller(policy)
+	calls := 0
+	_, err := Call(context.Background(), c, "getblock", func() (int, error) {
+		calls++
+		return 0, errRefused
+	})
+	if err == nil || calls != 3 || !errors.Is(err, errRefused) {
+		t.Error("wrong give up", calls, err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.MaxRetries = 0
+	policy.BreakerThreshold = 3
+	c, _ := testCaller(policy)
+	now := time.Unix(1500000000, 0)
+	c.now = func() time.Time { return now }
+	fail := func() (int, error) { return 0, errRefused }
+
+	for i := 0; i < 3; i++ {
+		if _, err := Call(context.Background(), c, "getblockcount", fail); !errors.Is(err, errRefused) {
+			t.Fatal("unexpected error", err)
+		}
+	}
+	calls := 0
+	_, err := Call(context.Background(), c, "getblockcount", func() (int, error) {
+		calls++
+		return 1, nil
+	})
+	if !errors.Is(err, ErrCircuitOpen) || calls != 0 {
+		t.Fatal("circuit didn't open", err)
+	}
+
+	// Half open after the cooldown, one failure opens it again
+	now = now.Add(policy.BreakerCooldown.Duration)
+	Call(context.Background(), c, "getblockcount", fail)
+	if _, err := Call(context.Background(), c, "getblockcount", fail); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("circuit didn't reopen", err)
+	}
+
+	now = now.Add(policy.BreakerCooldown.Duration)
+	if val, err := Call(context.Background(), c, "getblockcount", func() (int, error) { return 7, nil }); err != nil || val != 7 {
+		t.Fatal("circuit didn't close", err)
+	}
+}
+
+func TestReconnectOnUnauthorized(t *testing.T) {
+	c, _ := testCaller(DefaultPolicy())
+	reconnects := 0
+	c.Reconnect = func() error {
+		reconnects++
+		return nil
+	}
+	calls := 0
+	_, err := Call(context.Background(), c, "getblockcount", func() (int, error) {
+		calls++
+		if reconnects == 0 {
+			return 0, errors.New("status code: 401, response: \"\"")
+		}
+		return 1, nil
+	})
+	if err != nil || reconnects != 1 || calls != 2 {
+		t.Error("no reconnect", reconnects, calls, err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.MaxRetries = 0
+	policy.Timeout = Duration{10 * time.Millisecond}
+	c, _ := testCaller(policy)
+	block := make(chan struct{})
+	defer close(block)
+	_, err := Call(context.Background(), c, "getblock", func() (int, error) {
+		<-block
+		return 0, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("no timeout", err)
+	}
+}
@@ -0,0 +1,95 @@
+package signer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcutil"
+	"golang.org/x/crypto/scrypt"
+	"strings"
+)
+
+// scrypt cost of new key files, about 100ms on a laptop
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrBadPassphrase = errors.New("wrong passphrase or corrupted key file")
+
+// An encrypted key file: the WIF sealed with AES-256-GCM under a key
+// derived from the passphrase with scrypt
+type keyFile struct {
+	Version    int
+	KDF        string
+	N, R, P    int
+	Salt       []byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// EncryptKey returns the key file content protecting wif with passphrase
+func EncryptKey(wif *btcutil.WIF, passphrase []byte) ([]byte, error) {
+	f := &keyFile{Version: 1, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return nil, err
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, []byte(wif.String()), nil)
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// DecryptKey opens a key file written by EncryptKey
+func DecryptKey(data, passphrase []byte) (*btcutil.WIF, error) {
+	f := &keyFile{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("invalid key file: %s", err)
+	}
+	if f.Version != 1 || f.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key file version %d, kdf %q", f.Version, f.KDF)
+	}
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, ErrBadPassphrase
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return btcutil.DecodeWIF(string(plain))
+}
+
+func (f *keyFile) aead(passphrase []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, f.Salt, f.N, f.R, f.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ParseWIF reads a WIF as found in a key file or on stdin
+func ParseWIF(s string) (*btcutil.WIF, error) {
+	wif, err := btcutil.DecodeWIF(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WIF: %s", err)
+	}
+	return wif, nil
+}
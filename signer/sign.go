@@ -0,0 +1,71 @@
+// Package signer signs the opreturn tool's txs in-process with a local key,
+// so the hot wallet doesn't have to live inside bitcoind. It handles the
+// single key scripts a WIF can pay to: P2PKH and P2WPKH.
+package signer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// P2PKHScript returns the pk_script paying to a pubkey hash
+func P2PKHScript(pubKeyHash []byte) []byte {
+	script, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+		AddData(pubKeyHash).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+	return script
+}
+
+// P2WPKHScript returns the version 0 witness pk_script paying to a pubkey
+// hash
+func P2WPKHScript(pubKeyHash []byte) []byte {
+	script, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(pubKeyHash).Script()
+	return script
+}
+
+// PkScripts returns the P2PKH and P2WPKH pk_scripts of key
+func PkScripts(key *btcutil.WIF) (p2pkh, p2wpkh []byte) {
+	hash := btcutil.Hash160(key.SerializePubKey())
+	return P2PKHScript(hash), P2WPKHScript(hash)
+}
+
+// Sign signs every input of tx with key, prevOuts[i] being the output spent
+// by input i. All the inputs must pay to key.
+func Sign(tx *wire.MsgTx, prevOuts []*wire.TxOut, key *btcutil.WIF) error {
+	if len(prevOuts) != len(tx.TxIn) {
+		return fmt.Errorf("%d outputs spent by %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+	p2pkh, p2wpkh := PkScripts(key)
+
+	// The scripts are only set once all inputs are signed, so that an error
+	// leaves tx untouched
+	scriptSigs := make([][]byte, len(tx.TxIn))
+	witnesses := make([]wire.TxWitness, len(tx.TxIn))
+	sigHashes := txscript.NewTxSigHashes(tx)
+	for i, prevOut := range prevOuts {
+		var err error
+		switch {
+		case bytes.Equal(prevOut.PkScript, p2pkh):
+			scriptSigs[i], err = txscript.SignatureScript(tx, i, p2pkh, txscript.SigHashAll,
+				key.PrivKey, key.CompressPubKey)
+		case bytes.Equal(prevOut.PkScript, p2wpkh):
+			if !key.CompressPubKey {
+				return fmt.Errorf("input %d: segwit needs a compressed key", i)
+			}
+			witnesses[i], err = txscript.WitnessSignature(tx, sigHashes, i, prevOut.Value, p2wpkh,
+				txscript.SigHashAll, key.PrivKey, true)
+		default:
+			return fmt.Errorf("input %d: output %x isn't paid to the key", i, prevOut.PkScript)
+		}
+		if err != nil {
+			return fmt.Errorf("input %d: %s", i, err)
+		}
+	}
+	for i, txIn := range tx.TxIn {
+		txIn.SignatureScript = scriptSigs[i]
+		txIn.Witness = witnesses[i]
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"strings"
+	"testing"
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func decodeTx(t *testing.T, s string) *wire.MsgTx {
+	tx := &wire.MsgTx{}
+	if err := tx.Deserialize(bytes.NewReader(mustHex(s))); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// The private key 0c28fca3...d, compressed and not
+const (
+	compressedWIF   = "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617"
+	uncompressedWIF = "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ"
+)
+
+func spendingTx(t *testing.T, inputs int) *wire.MsgTx {
+	// Inputs spending 1111..11:0, one P2WPKH output
+	return decodeTx(t, "01000000"+fmt.Sprintf("%02x", inputs)+
+		strings.Repeat(strings.Repeat("11", 32)+"00000000"+"00"+"ffffffff", inputs)+
+		"01"+"1027000000000000"+"160014"+strings.Repeat("22", 20)+"00000000")
+}
+
+// Runs the script of input idx against the output it spends
+func verify(t *testing.T, name string, tx *wire.MsgTx, idx int, prevOut *wire.TxOut) {
+	engine, err := txscript.NewEngine(prevOut.PkScript, tx, idx, txscript.StandardVerifyFlags, nil,
+		txscript.NewTxSigHashes(tx), prevOut.Value)
+	if err != nil {
+		t.Error(name, err)
+		return
+	}
+	if err := engine.Execute(); err != nil {
+		t.Error(name, "invalid signature:", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	wif, err := ParseWIF(compressedWIF + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pkh, p2wpkh := PkScripts(wif)
+	if hex.EncodeToString(p2pkh) != "76a914d9351dcbad5b8f3b8bfa2f2cdc85c28118ca932688ac" {
+		t.Fatal("wrong p2pkh script", hex.EncodeToString(p2pkh))
+	}
+
+	tx := spendingTx(t, 2)
+	prevOuts := []*wire.TxOut{wire.NewTxOut(50000, p2pkh), wire.NewTxOut(70000, p2wpkh)}
+	if err := Sign(tx, prevOuts, wif); err != nil {
+		t.Fatal(err)
+	}
+	pubKey := wif.SerializePubKey()
+
+	// scriptSig: <sig> <pubkey>
+	scriptSig := tx.TxIn[0].SignatureScript
+	if len(scriptSig) < 2 || int(scriptSig[0]) != len(scriptSig)-35 || !bytes.HasSuffix(scriptSig, append([]byte{33}, pubKey...)) {
+		t.Fatal("wrong p2pkh scriptSig", hex.EncodeToString(scriptSig))
+	}
+	verify(t, "p2pkh", tx, 0, prevOuts[0])
+	if len(tx.TxIn[0].Witness) != 0 {
+		t.Error("p2pkh input has a witness")
+	}
+
+	witness := tx.TxIn[1].Witness
+	if len(tx.TxIn[1].SignatureScript) != 0 || len(witness) != 2 || !bytes.Equal(witness[1], pubKey) {
+		t.Fatal("wrong p2wpkh witness", witness)
+	}
+	verify(t, "p2wpkh", tx, 1, prevOuts[1])
+}
+
+func TestSignErrors(t *testing.T) {
+	wif, _ := ParseWIF(compressedWIF)
+	_, p2wpkh := PkScripts(wif)
+	other := P2WPKHScript(bytes.Repeat([]byte{0x33}, 20))
+	if err := Sign(spendingTx(t, 1), []*wire.TxOut{wire.NewTxOut(1, other)}, wif); err == nil {
+		t.Error("signed an output of another key")
+	}
+	if err := Sign(spendingTx(t, 2), []*wire.TxOut{wire.NewTxOut(1, p2wpkh)}, wif); err == nil {
+		t.Error("signed without every spent output")
+	}
+
+	uncompressed, _ := ParseWIF(uncompressedWIF)
+	_, p2wpkh = PkScripts(uncompressed)
+	if err := Sign(spendingTx(t, 1), []*wire.TxOut{wire.NewTxOut(1, p2wpkh)}, uncompressed); err == nil {
+		t.Error("segwit signed with an uncompressed key")
+	}
+	if _, err := ParseWIF("5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTj"); err == nil {
+		t.Error("accepted a bad checksum")
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	wif, _ := ParseWIF(compressedWIF)
+	data, err := EncryptKey(wif, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(compressedWIF)) {
+		t.Fatal("key file holds the WIF in clear")
+	}
+	key, err := DecryptKey(data, []byte("correct horse"))
+	if err != nil || key.String() != compressedWIF {
+		t.Error("wrong decrypted key", err)
+	}
+	if _, err := DecryptKey(data, []byte("battery staple")); err != ErrBadPassphrase {
+		t.Error("wrong passphrase accepted", err)
+	}
+	if _, err := DecryptKey([]byte(`{"Version": 2}`), nil); err == nil {
+		t.Error("unknown version accepted")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	zmq "github.com/pebbe/zmq4"
+	"os"
+	"time"
+)
+
+// A sink receives every serialized ProcessedBlock
+type sink interface {
+	Publish(data []byte) error
+	Close() error
+	Name() string
+}
+
+// Publishes blocks on a ZMQ PUB socket, as consumed by client.go
+type zmqSink struct {
+	socket   *zmq.Socket
+	endpoint string
+}
+
+func newZmqSink(endpoint string) (*zmqSink, error) {
+	socket, err := zmq.NewSocket(zmq.PUB)
+	if err != nil {
+		return nil, err
+	}
+	if err := socket.Bind(endpoint); err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("failed to bind %s: %s", endpoint, err)
+	}
+	return &zmqSink{socket, endpoint}, nil
+}
+
+func (s *zmqSink) Publish(data []byte) error {
+	_, err := s.socket.SendBytes(data, 0)
+	return err
+}
+
+// Pending messages get zmqLinger to go out before the socket is dropped
+const zmqLinger = 5 * time.Second
+
+func (s *zmqSink) Close() error {
+	s.socket.SetLinger(zmqLinger)
+	return s.socket.Close()
+}
+
+func (s *zmqSink) Name() string {
+	return "zmq:" + s.endpoint
+}
+
+// Appends blocks to a file, one hex encoded message per line
+type fileSink struct {
+	file *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file}, nil
+}
+
+func (s *fileSink) Publish(data []byte) error {
+	_, err := fmt.Fprintln(s.file, hex.EncodeToString(data))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+func (s *fileSink) Name() string {
+	return "file:" + s.file.Name()
+}
+
+func openSinks(confs []SinkConf) ([]sink, error) {
+	var sinks []sink
+	for _, c := range confs {
+		var s sink
+		var err error
+		switch c.Type {
+		case "zmq":
+			s, err = newZmqSink(c.Address)
+		case "file":
+			s, err = newFileSink(c.Address)
+		default:
+			err = fmt.Errorf("unknown sink type %q", c.Type)
+		}
+		if err != nil {
+			closeSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// Closes every sink, then waits for ZMQ to drain the closed sockets
+func closeSinks(sinks []sink) (ok bool) {
+	ok = true
+	hasZmq := false
+	for _, s := range sinks {
+		if _, isZmq := s.(*zmqSink); isZmq {
+			hasZmq = true
+		}
+		if err := s.Close(); err != nil {
+			logger.Crit("failed to close sink", "sink", s.Name(), "err", err)
+			ok = false
+		}
+	}
+	if hasZmq {
+		if err := zmq.Term(); err != nil {
+			logger.Crit("zmq term failed", "err", err)
+			ok = false
+		}
+	}
+	return
+}
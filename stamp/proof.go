@@ -0,0 +1,103 @@
+package stamp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Proof is the file written by stamp: the anchored root, the tx carrying it
+// and, for every file, its hash and Merkle path. Block is filled once the tx
+// is confirmed.
+type Proof struct {
+	Version     int
+	Network     string
+	Root        string
+	Txid        string
+	BlockHash   string `json:",omitempty"`
+	BlockHeight int64  `json:",omitempty"`
+	Files       []FileProof
+}
+
+type FileProof struct {
+	Name   string
+	SHA256 string
+	Path   []Step
+}
+
+// NewProof hashes the files and builds the tree over them, in order
+func NewProof(names []string) (*Proof, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no file to stamp")
+	}
+	leaves := make([]Hash, len(names))
+	for i, name := range names {
+		var err error
+		if leaves[i], err = HashFile(name); err != nil {
+			return nil, err
+		}
+	}
+	p := &Proof{Version: Version, Root: MerkleRoot(leaves).String()}
+	for i, name := range names {
+		p.Files = append(p.Files, FileProof{
+			Name:   name,
+			SHA256: leaves[i].String(),
+			Path:   MerklePath(leaves, i),
+		})
+	}
+	return p, nil
+}
+
+// RootHash returns the parsed Root
+func (p *Proof) RootHash() (Hash, error) {
+	return ParseHash(p.Root)
+}
+
+// Check returns an error unless the file's path leads to the root
+func (p *Proof) Check(f *FileProof) error {
+	leaf, err := ParseHash(f.SHA256)
+	if err != nil {
+		return err
+	}
+	root, err := RootFromPath(leaf, f.Path)
+	if err != nil {
+		return err
+	}
+	if root.String() != p.Root {
+		return fmt.Errorf("%s: path leads to %s, not the stamped root %s", f.Name, root, p.Root)
+	}
+	return nil
+}
+
+// Find returns the entry of the file hashing to h, nil if none
+func (p *Proof) Find(h Hash) *FileProof {
+	for i := range p.Files {
+		if p.Files[i].SHA256 == h.String() {
+			return &p.Files[i]
+		}
+	}
+	return nil
+}
+
+func ReadProof(path string) (*Proof, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proof{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if p.Version != Version {
+		return nil, fmt.Errorf("%s: unknown proof version %d", path, p.Version)
+	}
+	return p, nil
+}
+
+func (p *Proof) Write(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
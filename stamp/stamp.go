@@ -0,0 +1,169 @@
+// Package stamp anchors document hashes in OP_RETURN outputs. Files are
+// hashed with SHA256, several files are combined in a Merkle tree, and the
+// root is embedded after a protocol tag. A Proof keeps what is needed to show
+// later that a file was part of the anchored tree.
+package stamp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Tag starts every stamp payload, followed by Version and the 32 byte root
+const (
+	Tag     = "BWST"
+	Version = 1
+)
+
+// PayloadSize is what a stamp takes in an OP_RETURN push
+const PayloadSize = len(Tag) + 1 + sha256.Size
+
+var ErrNotStamp = errors.New("not a stamp payload")
+
+// Hash is a SHA256 digest, printed in sha256sum's byte order
+type Hash [sha256.Size]byte
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(h) {
+		return h, fmt.Errorf("invalid hash %q", s)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+func HashFile(path string) (Hash, error) {
+	var h Hash
+	f, err := os.Open(path)
+	if err != nil {
+		return h, err
+	}
+	defer f.Close()
+	s := sha256.New()
+	if _, err := io.Copy(s, f); err != nil {
+		return h, err
+	}
+	copy(h[:], s.Sum(nil))
+	return h, nil
+}
+
+// Leaves and inner nodes hash under different prefixes, as in RFC 6962, so
+// an inner node can't pass for the hash of a file
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+func leaf(file Hash) Hash {
+	return sha256.Sum256(append([]byte{leafPrefix}, file[:]...))
+}
+
+func node(left, right Hash) Hash {
+	data := make([]byte, 0, 1+2*sha256.Size)
+	data = append(data, nodePrefix)
+	data = append(data, left[:]...)
+	return sha256.Sum256(append(data, right[:]...))
+}
+
+// Step is a sibling on the way from a leaf to the root. Left tells whether
+// the sibling is hashed before the current node.
+type Step struct {
+	Hash string
+	Left bool
+}
+
+// MerkleRoot returns the root over the file hashes. An odd node at the end
+// of a level moves up unchanged: pairing it with itself, as Bitcoin does,
+// lets two lists of files share a root (CVE-2012-2459).
+func MerkleRoot(files []Hash) Hash {
+	if len(files) == 0 {
+		return Hash{}
+	}
+	level := leafLevel(files)
+	for len(level) > 1 {
+		level = nextLevel(level)
+	}
+	return level[0]
+}
+
+func leafLevel(files []Hash) []Hash {
+	level := make([]Hash, len(files))
+	for i, file := range files {
+		level[i] = leaf(file)
+	}
+	return level
+}
+
+func nextLevel(level []Hash) []Hash {
+	next := make([]Hash, 0, (len(level)+1)/2)
+	for i := 0; i+1 < len(level); i += 2 {
+		next = append(next, node(level[i], level[i+1]))
+	}
+	if len(level)%2 == 1 {
+		next = append(next, level[len(level)-1])
+	}
+	return next
+}
+
+// MerklePath returns the siblings linking files[index] to the root. A
+// promoted node has no sibling on its level.
+func MerklePath(files []Hash, index int) []Step {
+	var path []Step
+	level := leafLevel(files)
+	for len(level) > 1 {
+		if sibling := index ^ 1; sibling < len(level) {
+			path = append(path, Step{level[sibling].String(), sibling < index})
+		}
+		level = nextLevel(level)
+		index /= 2
+	}
+	return path
+}
+
+// RootFromPath hashes a file's hash up the path
+func RootFromPath(file Hash, path []Step) (Hash, error) {
+	h := leaf(file)
+	for _, step := range path {
+		sibling, err := ParseHash(step.Hash)
+		if err != nil {
+			return h, err
+		}
+		if step.Left {
+			h = node(sibling, h)
+		} else {
+			h = node(h, sibling)
+		}
+	}
+	return h, nil
+}
+
+// Payload returns the data to push in the OP_RETURN for root
+func Payload(root Hash) []byte {
+	payload := make([]byte, 0, PayloadSize)
+	payload = append(payload, Tag...)
+	payload = append(payload, Version)
+	return append(payload, root[:]...)
+}
+
+// ParsePayload returns the root of a stamp payload
+func ParsePayload(data []byte) (Hash, error) {
+	var root Hash
+	if len(data) != PayloadSize || !bytes.HasPrefix(data, []byte(Tag)) {
+		return root, ErrNotStamp
+	}
+	if v := data[len(Tag)]; v != Version {
+		return root, fmt.Errorf("unknown stamp version %d", v)
+	}
+	copy(root[:], data[len(Tag)+1:])
+	return root, nil
+}
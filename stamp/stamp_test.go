@@ -0,0 +1,134 @@
+package stamp
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func leaves(n int) []Hash {
+	hashes := make([]Hash, n)
+	for i := range hashes {
+		hashes[i] = sha256.Sum256([]byte{byte(i)})
+	}
+	return hashes
+}
+
+func TestMerkle(t *testing.T) {
+	one := leaves(1)
+	if MerkleRoot(one) != leaf(one[0]) || len(MerklePath(one, 0)) != 0 {
+		t.Error("wrong root of a single leaf")
+	}
+	if MerkleRoot(one) == one[0] {
+		t.Error("leaf hashed without prefix")
+	}
+	two := leaves(2)
+	if MerkleRoot(two) != node(leaf(two[0]), leaf(two[1])) {
+		t.Error("wrong root of two leaves")
+	}
+	three := leaves(3)
+	if MerkleRoot(three) != node(node(leaf(three[0]), leaf(three[1])), leaf(three[2])) {
+		t.Error("odd leaf not promoted")
+	}
+	if len(MerklePath(three, 2)) != 1 || len(MerklePath(three, 0)) != 2 {
+		t.Error("promoted leaf has a step of its own")
+	}
+	// Duplicating the last file must change the root, unlike in Bitcoin
+	four := append(leaves(3), three[2])
+	if MerkleRoot(four) == MerkleRoot(three) {
+		t.Error("duplicated leaf keeps the root")
+	}
+	// An inner node isn't a file hash of the tree
+	inner := node(leaf(two[0]), leaf(two[1]))
+	if got, _ := RootFromPath(inner, nil); got == MerkleRoot(two) {
+		t.Error("inner node passes for a leaf")
+	}
+	// Known answer, so the tree can't change without a new Version
+	if got := MerkleRoot(three).String(); got != "d1f13800048f5909d4043fc0c152f6643280cba608b672715e56ce159a20629f" {
+		t.Error("root of three leaves changed", got)
+	}
+	for n := 1; n <= 9; n++ {
+		hashes := leaves(n)
+		root := MerkleRoot(hashes)
+		for i := range hashes {
+			got, err := RootFromPath(hashes[i], MerklePath(hashes, i))
+			if err != nil || got != root {
+				t.Error("wrong path", n, i, err)
+			}
+		}
+	}
+	path := MerklePath(leaves(4), 2)
+	path[0].Left = !path[0].Left
+	if got, _ := RootFromPath(leaves(4)[2], path); got == MerkleRoot(leaves(4)) {
+		t.Error("swapped step still leads to the root")
+	}
+}
+
+func TestPayload(t *testing.T) {
+	root := leaves(1)[0]
+	payload := Payload(root)
+	if len(payload) != PayloadSize || string(payload[:4]) != "BWST" || payload[4] != 1 {
+		t.Errorf("wrong payload %x", payload)
+	}
+	if got, err := ParsePayload(payload); err != nil || got != root {
+		t.Error("ParsePayload failed", err)
+	}
+	if _, err := ParsePayload([]byte("hello")); err != ErrNotStamp {
+		t.Error("hello parsed as a stamp", err)
+	}
+	payload[4] = 2
+	if _, err := ParsePayload(payload); err == nil {
+		t.Error("unknown version accepted")
+	}
+}
+
+func TestProof(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var names []string
+	for _, content := range []string{"abc", "def", "ghi"} {
+		name := filepath.Join(dir, content+".txt")
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	p, err := NewProof(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Files[0].SHA256 != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Error("wrong file hash", p.Files[0].SHA256)
+	}
+	p.Txid = "00"
+	proofPath := filepath.Join(dir, "proof.json")
+	if err := p.Write(proofPath); err != nil {
+		t.Fatal(err)
+	}
+	p, err = ReadProof(proofPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range p.Files {
+		if err := p.Check(&p.Files[i]); err != nil {
+			t.Error(err)
+		}
+	}
+	h, _ := HashFile(names[1])
+	if f := p.Find(h); f == nil || f.Name != names[1] {
+		t.Error("Find failed")
+	}
+	p.Files[1].SHA256 = p.Files[0].SHA256
+	if err := p.Check(&p.Files[1]); err == nil {
+		t.Error("wrong hash checked")
+	}
+	if _, err := NewProof(nil); err == nil {
+		t.Error("empty proof built")
+	}
+}
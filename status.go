@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// watchStatus is what /status reports, updated by the block processing
+type watchStatus struct {
+	sync.Mutex
+	Started       time.Time
+	LastHeight    int64
+	LastHash      string
+	LastProcessed time.Time
+	NodeTip       int64
+	Published     uint64
+	PublishErrors uint64
+	OpReturnTxs   uint64
+	LastError     string
+	LastErrorTime time.Time
+	ShuttingDown  bool
+}
+
+var status = &watchStatus{Started: time.Now(), LastHeight: -1, NodeTip: -1}
+
+func (s *watchStatus) setTip(tip int64) {
+	s.Lock()
+	defer s.Unlock()
+	s.NodeTip = tip
+}
+
+func (s *watchStatus) processed(height int64, hash string, opReturnTxs int) {
+	s.Lock()
+	defer s.Unlock()
+	s.LastHeight = height
+	s.LastHash = hash
+	s.LastProcessed = time.Now()
+	s.OpReturnTxs += uint64(opReturnTxs)
+}
+
+func (s *watchStatus) published(err error) {
+	s.Lock()
+	defer s.Unlock()
+	if err != nil {
+		s.PublishErrors++
+	} else {
+		s.Published++
+	}
+}
+
+func (s *watchStatus) restore(cp *checkpoint) {
+	s.Lock()
+	defer s.Unlock()
+	s.LastHeight = cp.Height
+	s.LastHash = cp.Hash
+}
+
+func (s *watchStatus) checkpoint() *checkpoint {
+	s.Lock()
+	defer s.Unlock()
+	if s.LastHeight < 0 {
+		return nil
+	}
+	return &checkpoint{s.LastHeight, s.LastHash}
+}
+
+func (s *watchStatus) setShuttingDown() {
+	s.Lock()
+	defer s.Unlock()
+	s.ShuttingDown = true
+}
+
+func (s *watchStatus) isShuttingDown() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.ShuttingDown
+}
+
+func (s *watchStatus) failed(err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.LastError = err.Error()
+	s.LastErrorTime = time.Now()
+}
+
+func healthz(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "ok\n")
+}
+
+// Ready once bitcoind answers and the sinks are open
+func readyz(w http.ResponseWriter, r *http.Request) {
+	if status.isShuttingDown() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if len(sinks) == 0 {
+		http.Error(w, "sinks not started", http.StatusServiceUnavailable)
+		return
+	}
+	rpcStart := time.Now()
+	tip, err := rpcClient().GetBlockCount()
+	observeRPC("getblockcount", rpcStart, err)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bitcoind rpc failed: %s", err), http.StatusServiceUnavailable)
+		return
+	}
+	status.setTip(tip)
+	nodeTip.Set(float64(tip))
+	io.WriteString(w, "ok\n")
+}
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	status.Lock()
+	res := struct {
+		Network       string
+		Uptime        string
+		LastHeight    int64
+		LastHash      string
+		LastProcessed *time.Time `json:",omitempty"`
+		NodeTip       int64
+		Lag           int64
+		Published     uint64
+		PublishErrors uint64
+		OpReturnTxs   uint64
+		LastError     string     `json:",omitempty"`
+		LastErrorTime *time.Time `json:",omitempty"`
+	}{
+		Network:       netParams.Name,
+		Uptime:        time.Since(status.Started).String(),
+		LastHeight:    status.LastHeight,
+		LastHash:      status.LastHash,
+		NodeTip:       status.NodeTip,
+		Published:     status.Published,
+		PublishErrors: status.PublishErrors,
+		OpReturnTxs:   status.OpReturnTxs,
+		LastError:     status.LastError,
+	}
+	if !status.LastProcessed.IsZero() {
+		t := status.LastProcessed
+		res.LastProcessed = &t
+	}
+	if !status.LastErrorTime.IsZero() {
+		t := status.LastErrorTime
+		res.LastErrorTime = &t
+	}
+	if status.NodeTip >= 0 && status.LastHeight >= 0 {
+		res.Lag = status.NodeTip - status.LastHeight
+	}
+	status.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,79 @@
+package txbuild
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcutil"
+	"strconv"
+	"strings"
+)
+
+// ParseAmount reads a CLI amount without going through float64: "0.0001"
+// and "0.0001btc" are in BTC, with at most 8 decimals, "10000sat" and
+// "10000sats" are in satoshis.
+func ParseAmount(s string) (btcutil.Amount, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	var sat int64
+	var err error
+	switch {
+	case strings.HasSuffix(v, "sats"):
+		sat, err = parseDigits(strings.TrimSuffix(v, "sats"))
+	case strings.HasSuffix(v, "sat"):
+		sat, err = parseDigits(strings.TrimSuffix(v, "sat"))
+	default:
+		sat, err = parseBtc(strings.TrimSuffix(v, "btc"))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %s", s, err)
+	}
+	if sat > btcutil.MaxSatoshi {
+		return 0, fmt.Errorf("invalid amount %q: more than 21M BTC", s)
+	}
+	return btcutil.Amount(sat), nil
+}
+
+func parseBtc(v string) (int64, error) {
+	whole, frac := v, ""
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		whole, frac = v[:i], v[i+1:]
+	}
+	if len(frac) > 8 {
+		return 0, fmt.Errorf("more than 8 decimals")
+	}
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("no digits")
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	w, err := parseDigits(whole)
+	if err != nil {
+		return 0, err
+	}
+	if w > btcutil.MaxSatoshi/btcutil.SatoshiPerBitcoin {
+		return 0, fmt.Errorf("more than 21M BTC")
+	}
+	f := int64(0)
+	if frac != "" {
+		if f, err = parseDigits(frac + strings.Repeat("0", 8-len(frac))); err != nil {
+			return 0, err
+		}
+	}
+	return w*btcutil.SatoshiPerBitcoin + f, nil
+}
+
+// Only plain decimal digits: no sign, exponent or separators
+func parseDigits(v string) (int64, error) {
+	if v == "" {
+		return 0, fmt.Errorf("no digits")
+	}
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("out of range")
+	}
+	return n, nil
+}
@@ -0,0 +1,45 @@
+package txbuild
+
+import (
+	"github.com/btcsuite/btcutil"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	var good = []struct {
+		in  string
+		sat btcutil.Amount
+	}{
+		{"1", 100000000},
+		{"0.1", 10000000},
+		{".5", 50000000},
+		{"2.", 200000000},
+		{"0.00000001", 1},
+		{"0.29", 29000000}, // 0.29 * 1e8 truncates to 28999999
+		{"1.1BTC", 110000000},
+		{" 0.0002 ", 20000},
+		{"546sat", 546},
+		{"1000sats", 1000},
+		{"0", 0},
+		{"21000000", btcutil.MaxSatoshi},
+	}
+	for _, test := range good {
+		sat, err := ParseAmount(test.in)
+		if err != nil || sat != test.sat {
+			t.Error("wrong amount", test.in, sat, err)
+		}
+	}
+
+	var bad = []string{
+		"", ".", "btc", "sat", "-1", "+1", "1e-3", "0x10", "1,5",
+		"0.000000001",       // 9 decimals
+		"1.5sat",            // fractional satoshis
+		"21000000.00000001", // above the supply
+		"99999999999999999999",
+	}
+	for _, in := range bad {
+		if sat, err := ParseAmount(in); err == nil {
+			t.Error("accepted", in, sat)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package txbuild
+
+import (
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// Bitcoin Core's default -dustrelayfee, in sat/vB
+const DustRelayFeeRate FeeRate = 3
+
+// Bytes of the input spending an output later, as Bitcoin Core counts them
+const (
+	spendInputSize        = 32 + 4 + 1 + 107 + 4
+	spendWitnessInputSize = 32 + 4 + 1 + 107/4 + 4
+)
+
+// DustThreshold returns the smallest value an output paying to pkScript may
+// have to be relayed: what spending it costs at DustRelayFeeRate. Null-data
+// outputs are never dust.
+func DustThreshold(pkScript []byte) btcutil.Amount {
+	if len(pkScript) > 0 && pkScript[0] == 0x6a {
+		return 0
+	}
+	size := int64(wire.NewTxOut(0, pkScript).SerializeSize())
+	if isWitnessProgram(pkScript) {
+		size += spendWitnessInputSize
+	} else {
+		size += spendInputSize
+	}
+	return btcutil.Amount(int64(DustRelayFeeRate) * size)
+}
+
+func IsDust(value btcutil.Amount, pkScript []byte) bool {
+	return value < DustThreshold(pkScript)
+}
+
+// A version opcode followed by a single 2 to 40 bytes push
+func isWitnessProgram(script []byte) bool {
+	if len(script) < 4 || len(script) > 42 {
+		return false
+	}
+	if script[0] != 0x00 && (script[0] < 0x51 || script[0] > 0x60) {
+		return false
+	}
+	return int(script[1]) == len(script)-2
+}
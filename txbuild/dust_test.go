@@ -0,0 +1,32 @@
+package txbuild
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDustThreshold(t *testing.T) {
+	p2sh, _ := hex.DecodeString("a914751e76e8199196d454941c45d1b3a323f1433bd687")
+	p2tr, _ := hex.DecodeString("5120" + "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+
+	// Bitcoin Core's GetDustThreshold at the default -dustrelayfee
+	var tests = []struct {
+		name   string
+		script []byte
+		dust   int64
+	}{
+		{"p2pkh", p2pkhScript, 546},
+		{"p2sh", p2sh, 540},
+		{"p2wpkh", p2wpkhScript, 294},
+		{"p2tr", p2tr, 330},
+		{"null data", []byte{0x6a, 0x01, 0x42}, 0},
+	}
+	for _, test := range tests {
+		if dust := DustThreshold(test.script); int64(dust) != test.dust {
+			t.Error(test.name, "threshold", dust, "want", test.dust)
+		}
+	}
+	if !IsDust(545, p2pkhScript) || IsDust(546, p2pkhScript) {
+		t.Error("wrong IsDust")
+	}
+}
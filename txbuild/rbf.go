@@ -0,0 +1,83 @@
+package txbuild
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// RBFSequence is the highest sequence signaling BIP125 replaceability,
+// leaving nLockTime enforced
+const RBFSequence = 0xfffffffd
+
+// IncrementalRelayFeeRate is bitcoind's default -incrementalrelayfee, sat/vB
+const IncrementalRelayFeeRate FeeRate = 1
+
+// SignalsRBF tells whether tx opts in to replacement: one of its inputs has
+// a sequence below 0xfffffffe
+func SignalsRBF(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence <= RBFSequence {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplacementFee returns the fee a replacement of vsize needs to be relayed
+// at rate: it must pay at least the fees it replaces, those of the evicted
+// descendants included, plus its own relay at the incremental rate (BIP125
+// rules 3 and 4)
+func ReplacementFee(replacedFees btcutil.Amount, vsize int64, rate FeeRate) btcutil.Amount {
+	fee := btcutil.Amount(rate.Fee(vsize))
+	if min := replacedFees + btcutil.Amount(IncrementalRelayFeeRate.Fee(vsize)); fee < min {
+		fee = min
+	}
+	return fee
+}
+
+// ReplacementChange returns the change left once a replacement pays fee
+// instead of oldFee, 0 when what is left is dust and goes to the fee too
+func ReplacementChange(change *wire.TxOut, oldFee, fee btcutil.Amount) (btcutil.Amount, error) {
+	left := btcutil.Amount(change.Value) - (fee - oldFee)
+	if left < 0 {
+		return 0, fmt.Errorf("the %s change can't pay a %s fee", btcutil.Amount(change.Value), fee)
+	}
+	if IsDust(left, change.PkScript) {
+		return 0, nil
+	}
+	return left, nil
+}
+
+// FindChange returns the index of the change of tx, -1 if it has none.
+// isChange must recognize change positively, from the address the tx was
+// built with: an output that is merely ours can be a payment to ourselves.
+// More than one match is an error, the change being ambiguous.
+func FindChange(tx *wire.MsgTx, isChange func(pkScript []byte) bool) (int, error) {
+	found := -1
+	for i, txOut := range tx.TxOut {
+		script := txOut.PkScript
+		if len(script) > 0 && script[0] == 0x6a {
+			continue
+		}
+		if !isChange(script) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("outputs %d and %d both look like change", found, i)
+		}
+		found = i
+	}
+	return found, nil
+}
+
+// CPFPFee returns the fee a child of childVSize must pay so that it and its
+// unconfirmed parent are mined together at rate, 0 when the parent already
+// pays that much
+func CPFPFee(parentFee btcutil.Amount, parentVSize, childVSize int64, rate FeeRate) btcutil.Amount {
+	fee := btcutil.Amount(rate.Fee(parentVSize+childVSize)) - parentFee
+	if fee < 0 {
+		return 0
+	}
+	return fee
+}
@@ -0,0 +1,96 @@
+package txbuild
+
+import (
+	"bytes"
+	"github.com/btcsuite/btcd/wire"
+	"testing"
+)
+
+func TestSignalsRBF(t *testing.T) {
+	tx := unsignedTx(2)
+	if SignalsRBF(tx) {
+		t.Error("final sequences signal rbf")
+	}
+	tx.TxIn[1].Sequence = 0xfffffffe
+	if SignalsRBF(tx) {
+		t.Error("0xfffffffe signals rbf")
+	}
+	tx.TxIn[1].Sequence = RBFSequence
+	if !SignalsRBF(tx) {
+		t.Error("rbf sequence not detected")
+	}
+}
+
+func TestReplacementFee(t *testing.T) {
+	// The new rate dominates
+	if fee := ReplacementFee(200, 200, 5); fee != 1000 {
+		t.Error("wrong fee", fee)
+	}
+	// Barely above the old fee: the incremental relay fee is added
+	if fee := ReplacementFee(1000, 200, 5); fee != 1200 {
+		t.Error("wrong fee", fee)
+	}
+	// The fees of evicted descendants count as replaced too
+	if fee := ReplacementFee(1000+3000, 200, 5); fee != 4200 {
+		t.Error("wrong fee with descendants", fee)
+	}
+}
+
+func TestReplacementChange(t *testing.T) {
+	change := &wire.TxOut{Value: 10000, PkScript: p2wpkhScript}
+	if left, err := ReplacementChange(change, 1000, 3000); err != nil || left != 8000 {
+		t.Error("wrong change", left, err)
+	}
+	// 200 sat of P2WPKH change is dust, it goes to the fee
+	if left, err := ReplacementChange(change, 1000, 10800); err != nil || left != 0 {
+		t.Error("dust change kept", left, err)
+	}
+	if left, err := ReplacementChange(change, 1000, 11000); err != nil || left != 0 {
+		t.Error("change spent to the last satoshi", left, err)
+	}
+	if _, err := ReplacementChange(change, 1000, 11001); err == nil {
+		t.Error("change paid more than it has")
+	}
+}
+
+func TestFindChange(t *testing.T) {
+	change := func(pkScript []byte) bool { return bytes.Equal(pkScript, p2wpkhScript) }
+	// Another address of ours, not a change one: a payment to ourselves
+	selfPayment := append([]byte{0x00, 0x14}, bytes.Repeat([]byte{0x77}, 20)...)
+	opReturn := []byte{0x6a, 0x01, 0x42}
+	var tests = []struct {
+		name    string
+		outputs [][]byte
+		change  int
+	}{
+		{"payment, change, op_return", [][]byte{p2pkhScript, p2wpkhScript, opReturn}, 1},
+		{"no op_return", [][]byte{p2pkhScript, p2wpkhScript}, 1},
+		{"no change", [][]byte{p2pkhScript, opReturn}, -1},
+		{"self-payment, no change", [][]byte{selfPayment, opReturn}, -1},
+		{"self-payment and change", [][]byte{selfPayment, p2wpkhScript, opReturn}, 1},
+		{"only op_return", [][]byte{opReturn}, -1},
+	}
+	for _, test := range tests {
+		got, err := FindChange(unsignedTx(1, test.outputs...), change)
+		if err != nil || got != test.change {
+			t.Error(test.name, "change at", got, "want", test.change, err)
+		}
+	}
+	if _, err := FindChange(unsignedTx(1, p2wpkhScript, p2pkhScript, p2wpkhScript, opReturn), change); err == nil {
+		t.Error("two change outputs found no ambiguity")
+	}
+	asked := 0
+	FindChange(unsignedTx(1, p2pkhScript, opReturn, opReturn), func([]byte) bool { asked++; return false })
+	if asked != 1 {
+		t.Error("op_return outputs looked up", asked)
+	}
+}
+
+func TestCPFPFee(t *testing.T) {
+	if fee := CPFPFee(200, 200, 110, 10); fee != 2900 {
+		t.Error("wrong fee", fee)
+	}
+	if fee := CPFPFee(5000, 200, 110, 10); fee != 0 {
+		t.Error("wrong fee for a parent paying enough", fee)
+	}
+}
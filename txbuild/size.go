@@ -0,0 +1,85 @@
+// Package txbuild holds the pure parts of building the opreturn tool's
+// transactions: size and fee estimation, so they can be tested without a
+// bitcoind wallet.
+package txbuild
+
+import (
+	"github.com/btcsuite/btcd/wire"
+	"math"
+)
+
+// Weight units of the signature data an input needs once signed
+const (
+	p2pkhSigWeight      = 107 * 4    // DER sig (72) + compressed pubkey (33) + pushes
+	p2pkSigWeight       = 73 * 4     // DER sig (72) + push
+	p2wpkhSigWeight     = 108        // witness: count, sig, pubkey
+	p2shP2wpkhSigWeight = 23*4 + 108 // redeem script push + witness
+	p2trSigWeight       = 66         // witness: count, schnorr sig
+	segwitMarkerWeight  = 2          // marker and flag bytes of a segwit tx
+)
+
+// FeeRate is in satoshis per virtual byte
+type FeeRate float64
+
+// InputSigWeight returns the weight a standard signature spending prevScript
+// adds to an unsigned input, and whether it goes in the witness
+func InputSigWeight(prevScript []byte) (weight int64, witness bool) {
+	n := len(prevScript)
+	switch {
+	case n == 22 && prevScript[0] == 0x00 && prevScript[1] == 0x14:
+		return p2wpkhSigWeight, true
+	case n == 34 && prevScript[0] == 0x51 && prevScript[1] == 0x20:
+		return p2trSigWeight, true
+	case n == 23 && prevScript[0] == 0xa9 && prevScript[1] == 0x14 && prevScript[22] == 0x87:
+		// Assume P2SH-P2WPKH, the only P2SH a wallet hands out by itself
+		return p2shP2wpkhSigWeight, true
+	case (n == 35 || n == 67) && prevScript[n-1] == 0xac:
+		return p2pkSigWeight, false
+	}
+	// P2PKH, and the best guess for anything else
+	return p2pkhSigWeight, false
+}
+
+// EstimateVSize returns the virtual size of tx once its inputs are signed.
+// prevScripts are the pk_scripts of the outputs spent by tx.TxIn, in order.
+func EstimateVSize(tx *wire.MsgTx, prevScripts [][]byte) int64 {
+	weight := int64(tx.SerializeSize()) * 4
+	witnessInputs := 0
+	for i := range tx.TxIn {
+		var prev []byte
+		if i < len(prevScripts) {
+			prev = prevScripts[i]
+		}
+		w, witness := InputSigWeight(prev)
+		weight += w
+		if witness {
+			witnessInputs++
+		}
+	}
+	if witnessInputs > 0 {
+		// Inputs without witness still get an empty witness count
+		weight += segwitMarkerWeight + int64(len(tx.TxIn)-witnessInputs)
+	}
+	return (weight + 3) / 4
+}
+
+// Fee returns the fee paying rate for vsize, rounded up
+func (rate FeeRate) Fee(vsize int64) int64 {
+	return int64(math.Ceil(float64(rate) * float64(vsize)))
+}
+
+// Clamp bounds rate by floor and ceiling, a zero bound is ignored
+func (rate FeeRate) Clamp(floor, ceiling FeeRate) FeeRate {
+	if floor > 0 && rate < floor {
+		rate = floor
+	}
+	if ceiling > 0 && rate > ceiling {
+		rate = ceiling
+	}
+	return rate
+}
+
+// FromBtcPerKvB converts the BTC/kvB rates of estimatesmartfee
+func FromBtcPerKvB(btcPerKvB float64) FeeRate {
+	return FeeRate(btcPerKvB * 1e8 / 1000)
+}
@@ -0,0 +1,64 @@
+package txbuild
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/wire"
+	"testing"
+)
+
+var (
+	p2pkhScript, _  = hex.DecodeString("76a914751e76e8199196d454941c45d1b3a323f1433bd688ac")
+	p2wpkhScript, _ = hex.DecodeString("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+)
+
+func unsignedTx(inputs int, outputs ...[]byte) *wire.MsgTx {
+	tx := &wire.MsgTx{Version: 1}
+	for i := 0; i < inputs; i++ {
+		tx.TxIn = append(tx.TxIn, &wire.TxIn{Sequence: 0xffffffff})
+	}
+	for _, script := range outputs {
+		tx.TxOut = append(tx.TxOut, &wire.TxOut{Value: 10000, PkScript: script})
+	}
+	return tx
+}
+
+func TestEstimateVSize(t *testing.T) {
+	opReturn := append([]byte{0x6a, 20}, bytes.Repeat([]byte{0x42}, 20)...)
+
+	var tests = []struct {
+		name  string
+		tx    *wire.MsgTx
+		prev  [][]byte
+		vsize int64
+	}{
+		// The classic 148 bytes P2PKH input
+		{"p2pkh", unsignedTx(1, p2pkhScript, p2pkhScript, opReturn), [][]byte{p2pkhScript}, 257},
+		{"2 p2pkh", unsignedTx(2, p2pkhScript, p2pkhScript), [][]byte{p2pkhScript, p2pkhScript}, 374},
+		{"p2wpkh", unsignedTx(1, p2wpkhScript, p2wpkhScript), [][]byte{p2wpkhScript}, 141},
+		{"mixed", unsignedTx(2, p2wpkhScript), [][]byte{p2pkhScript, p2wpkhScript}, 258},
+	}
+	for _, test := range tests {
+		if vsize := EstimateVSize(test.tx, test.prev); vsize != test.vsize {
+			t.Errorf("%s: vsize %d, want %d", test.name, vsize, test.vsize)
+		}
+	}
+}
+
+func TestFeeRate(t *testing.T) {
+	if fee := FeeRate(1.5).Fee(141); fee != 212 {
+		t.Error("wrong fee", fee)
+	}
+	if rate := FromBtcPerKvB(0.00012); rate < 11.999 || rate > 12.001 {
+		t.Error("wrong conversion", rate)
+	}
+	if rate := FeeRate(0.5).Clamp(1, 100); rate != 1 {
+		t.Error("floor not applied", rate)
+	}
+	if rate := FeeRate(500).Clamp(1, 100); rate != 100 {
+		t.Error("ceiling not applied", rate)
+	}
+	if rate := FeeRate(500).Clamp(0, 0); rate != 500 {
+		t.Error("zero bounds applied", rate)
+	}
+}